@@ -0,0 +1,1162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	spotify "spotify-cli/src"
+)
+
+// Exit codes of the subcommand mode
+const (
+	exitOK       = 0
+	exitFailure  = 1 // the request failed
+	exitUsage    = 2 // unknown command or invalid arguments
+	exitNoDevice = 3 // no active device to control
+)
+
+// usageError is a command that could not be run as typed, as opposed to a failed request
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// errQuit is returned by the quit command to end the interactive loop
+var errQuit = errors.New("quit")
+
+// session is the state shared by the commands of one run
+type session struct {
+	client   *spotify.SpotifyClient
+	renderer spotify.Renderer
+	out      io.Writer  // help text
+	console  io.Writer  // prompts and usage errors
+	prompt   lineReader // asks the user to choose; nil when running a single command
+
+	// Results of the last listings, referred to by number
+	lastSearchResults spotify.SearchResults
+	lastNewReleases   spotify.NewReleases
+	lastPlaylists     spotify.Playlists
+	lastDevices       []spotify.Device
+
+	// Jobs running in the background of the interactive loop, if any, and
+	// their errors, reported by the loop before the next prompt
+	fade      *backgroundJob
+	sleep     *backgroundJob
+	jobErrors chan error
+}
+
+// backgroundJob is a volume fade or sleep timer running in the background of
+// the interactive loop
+type backgroundJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	ends   time.Time
+}
+
+// registry lists every command; it drives the interactive loop, single command mode and help
+var registry []*command
+
+func init() {
+	registry = []*command{
+		{name: "search", args: []argSpec{{name: "query", kind: argRest, optional: true}}, flags: []flagSpec{
+			{name: "type", value: "types", help: "Comma-separated types to search: " + strings.Join(spotify.SearchTypes, ", "), values: spotify.SearchTypes},
+			{name: "artist", value: "name", help: "Only results by this artist"},
+			{name: "album", value: "name", help: "Only results from this album"},
+			{name: "year", value: "year", help: "Only results from a year or range of years, e.g. 1990-1999"},
+			{name: "genre", value: "genre", help: "Only artists and tracks of this genre"},
+			{name: "isrc", value: "code", help: "Only the track with this ISRC"},
+			{name: "tag", value: "tag", help: "Only new albums or the least popular ones (hipster)", values: searchTags},
+			{name: "market", value: "country", help: "Only content available in this country, e.g. US"},
+			{name: "limit", value: "number", help: fmt.Sprintf("Results per type and page (1-%d, default %d)", spotify.MaxSearchLimit, spotify.DefaultSearchLimit)},
+			{name: "offset", value: "number", help: fmt.Sprintf("Skip this many results of each type (0-%d)", spotify.MaxSearchOffset)},
+		}, help: "Search for tracks, or the given types", run: cmdSearch},
+		{name: "more", help: "Show the next page of search results", run: cmdMore},
+		{name: "back", help: "Show the previous page of search results", run: cmdBack},
+		{name: "play", args: []argSpec{{name: "number|uri", complete: completeSearchResults}},
+			help: "Play an item from search results, or a Spotify URI or open.spotify.com link", run: cmdPlay},
+		{name: "play-search", args: []argSpec{{name: "query", kind: argRest}}, flags: []flagSpec{
+			{name: "first", help: "Play the best match without asking when the query is ambiguous"},
+		}, help: "Search and play the best matching track, e.g. play-search one by metallica", run: cmdPlaySearch},
+		{name: "new", help: "Show new releases", run: cmdNew},
+		{name: "play-new", args: []argSpec{{name: "number", kind: argNumber, complete: completeNewReleases}}, flags: []flagSpec{
+			{name: "shuffle", help: "Turn on shuffle before playing"},
+		}, help: "Play album from new releases", run: cmdPlayNew},
+		{name: "queue", aliases: []string{"play-next"}, args: []argSpec{{name: "number|uri", optional: true, complete: completeSearchResults}}, flags: []flagSpec{
+			{name: "new", help: "The number refers to new releases rather than search results"},
+			{name: "all", help: "Queue every track and episode of the last search results"},
+		}, help: "Show the queue, or add a search result, Spotify URI or link to play after the current track", run: cmdQueue},
+		{name: "current", aliases: []string{"now"}, help: "Show current track", run: cmdCurrent},
+		{name: "toggle", help: "Play/Pause", run: cmdToggle},
+		{name: "playlists", help: "List all playlists", run: cmdPlaylists},
+		{name: "play-list", args: []argSpec{{name: "number|name", kind: argRest, complete: completePlaylists}}, flags: []flagSpec{
+			{name: "shuffle", help: "Turn on shuffle before playing"},
+		}, help: "Play playlist by its number in the list or its name", run: cmdPlayList},
+		{name: "volume", aliases: []string{"vol"}, args: []argSpec{{name: "percent"}},
+			help: "Set playback volume (0-100), or change it by +n or -n", run: cmdVolume},
+		{name: "mute", help: "Mute playback, remembering the volume", run: cmdMute},
+		{name: "unmute", help: "Restore the volume from before mute", run: cmdUnmute},
+		{name: "fade", args: []argSpec{{name: "percent|stop"}, {name: "duration", optional: true}},
+			help: "Change the volume gradually over a duration such as 30s or 2:00, or stop a running fade", run: cmdFade},
+		{name: "sleep", args: []argSpec{{name: "duration|cancel", optional: true}}, flags: []flagSpec{
+			{name: "end-of-track", help: "Pause when the current track ends"},
+			{name: "end-of-album", help: "Pause when the album or playlist that is playing ends"},
+			{name: "fade", help: "Fade the volume out over the last minute and restore it after pausing"},
+		}, help: "Pause playback after a duration such as 30m, or show or cancel the sleep timer", run: cmdSleep},
+		{name: "shuffle", args: []argSpec{{name: "mode", optional: true, values: shuffleModes}},
+			help: "Show whether shuffle is on, or turn it on, off or toggle it", run: cmdShuffle},
+		{name: "repeat", help: "Toggle repeat mode (off/track/context)", run: cmdRepeat},
+		{name: "repeat-mode", args: []argSpec{{name: "mode", optional: true, values: repeatModes}},
+			help: "Show the repeat mode, or set it (off/track/context/song/album/playlist)", run: cmdRepeatMode},
+		{name: "seek", args: []argSpec{{name: "position"}},
+			help: "Jump to a time (1:23, 90s), by an offset (+15s, -30s) or to a percentage (50%) of the current track", run: cmdSeek},
+		{name: "next", aliases: []string{"skip"}, help: "Skip to next track", run: cmdNext},
+		{name: "prev", aliases: []string{"previous"}, help: "Go back to previous track", run: cmdPrev},
+		{name: "devices", help: "List available devices", run: cmdDevices},
+		{name: "device", args: []argSpec{{name: "name|number", kind: argRest, optional: true, complete: completeDevices}}, flags: []flagSpec{
+			{name: "save", help: "Also play on this device in later sessions, when it is available"},
+			{name: "clear", help: "Forget the selected and the saved device"},
+		}, help: "Show the device to play on, or select one by name or its number in devices", run: cmdDevice},
+		{name: "transfer", args: []argSpec{{name: "name|number", kind: argRest, complete: completeDevices}}, flags: []flagSpec{
+			{name: "play", help: "Start playback on the device, even if it was paused"},
+		}, help: "Move playback to another device", run: cmdTransfer},
+		{name: "help", aliases: []string{"?"}, args: []argSpec{{name: "command", optional: true, complete: completeCommands}},
+			help: "Show the commands, or help for one command", run: cmdHelp, offline: true},
+		{name: "completion", args: []argSpec{{name: "shell", values: completionShells}},
+			help: "Print the completion script for bash, zsh or fish", run: cmdCompletion, offline: true},
+		{name: "__complete", args: []argSpec{{name: "words", kind: argWords, optional: true}},
+			help: "Print the completions of the last word, for the completion scripts", run: cmdComplete, offline: true, hidden: true},
+		{name: "quit", aliases: []string{"exit"}, help: "Exit the program", run: cmdQuit},
+	}
+}
+
+// searchTags are the values accepted by search --tag
+var searchTags = []string{"new", "hipster"}
+
+// shuffleModes are the values accepted by shuffle
+var shuffleModes = []string{"on", "off", "toggle"}
+
+// repeatModes are the values accepted by repeat-mode
+var repeatModes = []string{"off", "track", "context", "song", "album", "playlist"}
+
+// runCommand executes one command, given as its words, rendering its result.
+// It is shared by the interactive loop and the subcommand mode.
+func runCommand(s *session, words []string) error {
+	if len(words) == 0 {
+		return nil
+	}
+	cmd := lookupCommand(words[0])
+	if cmd == nil {
+		return unknownCommand(words[0])
+	}
+	args, flags, err := cmd.bind(words[1:])
+	if err != nil {
+		return err
+	}
+	return cmd.run(s, args, flags)
+}
+
+func cmdSearch(s *session, args []string, flags flagValues) error {
+	var types []string
+	if value, ok := flags["type"]; ok {
+		for _, searchType := range strings.Split(value, ",") {
+			searchType = strings.ToLower(strings.TrimSpace(searchType))
+			if !slices.Contains(spotify.SearchTypes, searchType) {
+				return usageError(fmt.Sprintf("Invalid search type: %s. Valid types are: %s", searchType, strings.Join(spotify.SearchTypes, ", ")))
+			}
+			if !slices.Contains(types, searchType) {
+				types = append(types, searchType)
+			}
+		}
+	}
+
+	limit, err := flags.number("limit", 1, spotify.MaxSearchLimit)
+	if err != nil {
+		return err
+	}
+	offset, err := flags.number("offset", 0, spotify.MaxSearchOffset)
+	if err != nil {
+		return err
+	}
+
+	options := spotify.SearchOptions{
+		Types: types,
+		Filters: spotify.SearchFilters{
+			Artist: flags["artist"],
+			Album:  flags["album"],
+			Year:   flags["year"],
+			Genre:  flags["genre"],
+			ISRC:   flags["isrc"],
+			Tag:    flags["tag"],
+		},
+		Market: flags["market"],
+		Limit:  limit,
+		Offset: offset,
+	}
+	query := ""
+	if len(args) > 0 {
+		query = args[0]
+	}
+	if _, err := options.Validate(query); err != nil {
+		return usageError("Invalid search: " + err.Error())
+	}
+
+	results, err := s.client.Search(query, options)
+	if err != nil {
+		return err
+	}
+	s.lastSearchResults = results
+	s.renderer.SearchResults(results)
+	return nil
+}
+
+func cmdMore(s *session, args []string, flags flagValues) error {
+	return s.searchPage(s.lastSearchResults.Next, "No more results")
+}
+
+func cmdBack(s *session, args []string, flags flagValues) error {
+	return s.searchPage(s.lastSearchResults.Previous, "Already at the first page")
+}
+
+// searchPage shows the page of the last search at link, which replaces the
+// numbered results
+func (s *session) searchPage(link, missing string) error {
+	if len(s.lastSearchResults.Items()) == 0 && s.lastSearchResults.Offset == 0 {
+		return usageError("No search results. Use 'search' first")
+	}
+	if link == "" {
+		return usageError(missing)
+	}
+	results, err := s.client.SearchPage(link)
+	if err != nil {
+		return err
+	}
+	s.lastSearchResults = results
+	s.renderer.SearchResults(results)
+	return nil
+}
+
+func cmdPlay(s *session, args []string, flags flagValues) error {
+	num, err := strconv.Atoi(args[0])
+	if err != nil {
+		uri, err := spotify.ParseURI(args[0])
+		if err != nil {
+			return usageError(fmt.Sprintf("Not a result number, Spotify URI or link: %s", args[0]))
+		}
+		playback, err := s.client.PlayURI(uri)
+		if err != nil {
+			return err
+		}
+		s.showPlayback(playback)
+		s.renderer.Message(fmt.Sprintf("Playing %s: %s", uri.Type, uri))
+		return nil
+	}
+
+	items := s.lastSearchResults.Items()
+	if num < 1 || num > len(items) {
+		return usageError("Invalid result number")
+	}
+
+	// Albums, artists, playlists and shows are played as a context
+	item := items[num-1]
+	playback, err := s.client.PlayURI(spotify.SpotifyURI{Type: item.Type, ID: item.ID})
+	if err != nil {
+		return err
+	}
+	s.showPlayback(playback)
+	s.renderer.Message(fmt.Sprintf("Playing %s: %s", item.Type, item.Name))
+	return nil
+}
+
+// showPlayback tells where playback was started, and why in the browser when
+// it could not start on a device
+func (s *session) showPlayback(playback spotify.Playback) {
+	if playback.Device.Name != "" {
+		s.renderer.Message("Using device: " + playback.Device.Name)
+	}
+	if playback.Browser != "" {
+		s.renderer.Message(fmt.Sprintf("Playback on a device failed: %v", playback.Fallback))
+		s.renderer.Message(fmt.Sprintf("Opened %s in %s", playback.URL, playback.Browser))
+	}
+}
+
+// playSearchLimit is the number of tracks play-search ranks
+const playSearchLimit = 20
+
+func cmdPlaySearch(s *session, args []string, flags flagValues) error {
+	// "title by artist" searches with an artist filter, unless nothing matches,
+	// as for a title such as "stand by me"
+	query := args[0]
+	title, artist := splitArtist(query)
+	var results spotify.SearchResults
+	var err error
+	if artist != "" {
+		options := spotify.SearchOptions{Filters: spotify.SearchFilters{Artist: artist}, Limit: playSearchLimit}
+		if results, err = s.client.Search(title, options); err != nil {
+			return err
+		}
+	}
+	if len(results.Tracks) == 0 {
+		title, artist = query, ""
+		if results, err = s.client.Search(query, spotify.SearchOptions{Limit: playSearchLimit}); err != nil {
+			return err
+		}
+	}
+	if len(results.Tracks) == 0 {
+		return fmt.Errorf("no tracks found for %s", query)
+	}
+
+	matches := spotify.RankTracks(results.Tracks, title, artist)
+	track := matches[0].Track
+	if candidates := spotify.CloseMatches(matches); len(candidates) > 1 && s.prompt != nil && flags["first"] == "" {
+		if track, err = s.chooseTrack(candidates); err != nil {
+			return err
+		}
+	}
+
+	playback, err := s.client.PlayTrack(track.URI)
+	if err != nil {
+		return err
+	}
+	s.showPlayback(playback)
+	s.renderer.Message("Playing track: " + track.Name)
+	return nil
+}
+
+// splitArtist splits a query such as "one by metallica" into title and artist
+func splitArtist(query string) (title, artist string) {
+	i := strings.LastIndex(strings.ToLower(query), " by ")
+	if i <= 0 {
+		return query, ""
+	}
+	return strings.TrimSpace(query[:i]), strings.TrimSpace(query[i+len(" by "):])
+}
+
+// chooseTrack lists the candidates and asks which one to play. They become the
+// search results, so they can also be played later by number.
+func (s *session) chooseTrack(candidates []spotify.TrackMatch) (spotify.Track, error) {
+	results := spotify.SearchResults{}
+	for _, candidate := range candidates {
+		results.Tracks = append(results.Tracks, candidate.Track)
+	}
+	s.lastSearchResults = results
+	s.renderer.SearchResults(results)
+
+	line, err := s.prompt.ReadLine(fmt.Sprintf("Play which one? [1-%d, Enter for 1]: ", len(results.Tracks)))
+	if err != nil {
+		return spotify.Track{}, usageError("Nothing played")
+	}
+	num := 1
+	if line = strings.TrimSpace(line); line != "" {
+		num, err = strconv.Atoi(line)
+		if err != nil || num < 1 || num > len(results.Tracks) {
+			return spotify.Track{}, usageError("Invalid track number")
+		}
+	}
+	return results.Tracks[num-1], nil
+}
+
+func cmdNew(s *session, args []string, flags flagValues) error {
+	results, err := s.client.GetNewReleases()
+	if err != nil {
+		return err
+	}
+	s.lastNewReleases = results
+	s.renderer.NewReleases(results)
+	return nil
+}
+
+func cmdPlayNew(s *session, args []string, flags flagValues) error {
+	num, _ := strconv.Atoi(args[0])
+	if num < 1 || num > len(s.lastNewReleases.Albums) {
+		return usageError("Invalid album number")
+	}
+
+	album := s.lastNewReleases.Albums[num-1]
+	if flags["shuffle"] != "" {
+		playback, err := s.client.PlayShuffled(spotify.SpotifyURI{Type: spotify.SearchTypeAlbum, ID: album.ID})
+		if err != nil {
+			return err
+		}
+		s.showPlayback(playback)
+		s.renderer.Message("Playing album shuffled: " + album.Name)
+		return nil
+	}
+	playback, err := s.client.PlayAlbum(album.ID)
+	if err != nil {
+		return err
+	}
+	s.showPlayback(playback)
+	s.renderer.Message("Playing album: " + album.Name)
+	return nil
+}
+
+func cmdQueue(s *session, args []string, flags flagValues) error {
+	if flags["all"] != "" {
+		if len(args) > 0 || flags["new"] != "" {
+			return usageError("--all does not take an item")
+		}
+		return s.queueSearchResults()
+	}
+
+	if len(args) == 0 {
+		queue, err := s.client.GetQueue()
+		if err != nil {
+			return err
+		}
+		s.renderer.Queue(queue)
+		return nil
+	}
+
+	var uri spotify.SpotifyURI
+	name := args[0]
+	if num, err := strconv.Atoi(args[0]); err != nil {
+		if uri, err = spotify.ParseURI(args[0]); err != nil {
+			return usageError(fmt.Sprintf("Not a result number, Spotify URI or link: %s", args[0]))
+		}
+		name = uri.String()
+	} else if flags["new"] != "" {
+		if num < 1 || num > len(s.lastNewReleases.Albums) {
+			return usageError("Invalid album number")
+		}
+		album := s.lastNewReleases.Albums[num-1]
+		uri, name = spotify.SpotifyURI{Type: spotify.SearchTypeAlbum, ID: album.ID}, album.Name
+	} else {
+		items := s.lastSearchResults.Items()
+		if num < 1 || num > len(items) {
+			return usageError("Invalid result number")
+		}
+		item := items[num-1]
+		uri, name = spotify.SpotifyURI{Type: item.Type, ID: item.ID}, item.Name
+	}
+
+	// Part of an album or playlist may be queued when a request fails, which
+	// the error tells, as the queue cannot be cleared
+	count, err := s.client.Enqueue(uri)
+	if err != nil && count > 0 {
+		return fmt.Errorf("error after queueing %d tracks of %s %s: %w", count, uri.Type, name, err)
+	}
+	if err != nil {
+		return err
+	}
+	if uri.IsContext() {
+		s.renderer.Message(fmt.Sprintf("Queued %d tracks of %s: %s", count, uri.Type, name))
+	} else {
+		s.renderer.Message(fmt.Sprintf("Queued %s: %s", uri.Type, name))
+	}
+	return nil
+}
+
+// queueSearchResults queues the tracks and episodes of the last search results
+// in the order they are listed
+func (s *session) queueSearchResults() error {
+	var uris []string
+	for _, item := range s.lastSearchResults.Items() {
+		if item.Type == spotify.SearchTypeTrack || item.Type == spotify.SearchTypeEpisode {
+			uris = append(uris, item.URI)
+		}
+	}
+	if len(uris) == 0 {
+		return usageError("No tracks or episodes to queue. Use 'search' first")
+	}
+
+	for i, uri := range uris {
+		err := s.client.AddToQueue(uri)
+		if err != nil && i > 0 {
+			return fmt.Errorf("error after queueing %d of %d items: %w", i, len(uris), err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	s.renderer.Message(fmt.Sprintf("Queued %d items", len(uris)))
+	return nil
+}
+
+func cmdCurrent(s *session, args []string, flags flagValues) error {
+	state, err := s.client.GetPlaybackState()
+	if err != nil {
+		return err
+	}
+	s.renderer.PlaybackState(state)
+	return nil
+}
+
+func cmdToggle(s *session, args []string, flags flagValues) error {
+	playing, err := s.client.TogglePlayback()
+	if err != nil {
+		return err
+	}
+	if playing {
+		s.renderer.Message("Playback resumed")
+	} else {
+		s.renderer.Message("Playback paused")
+	}
+	return nil
+}
+
+func cmdPlaylists(s *session, args []string, flags flagValues) error {
+	results, err := s.client.ListPlaylists()
+	if err != nil {
+		return err
+	}
+	s.lastPlaylists = results
+	s.renderer.Playlists(results)
+	return nil
+}
+
+func cmdPlayList(s *session, args []string, flags flagValues) error {
+	var playlist spotify.Playlist
+	if num, err := strconv.Atoi(args[0]); err == nil {
+		if num < 1 || num > len(s.lastPlaylists.Items) {
+			return usageError("Invalid playlist number")
+		}
+		playlist = s.lastPlaylists.Items[num-1]
+	} else {
+		playlists, err := s.playlists()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, item := range playlists.Items {
+			if strings.EqualFold(item.Name, args[0]) {
+				playlist, found = item, true
+				break
+			}
+		}
+		if !found {
+			return usageError("No playlist named " + args[0])
+		}
+	}
+
+	if flags["shuffle"] != "" {
+		playback, err := s.client.PlayShuffled(spotify.SpotifyURI{Type: spotify.SearchTypePlaylist, ID: playlist.ID})
+		if err != nil {
+			return err
+		}
+		s.showPlayback(playback)
+		s.renderer.Message("Playing playlist shuffled: " + playlist.Name)
+		return nil
+	}
+	playback, err := s.client.PlayPlaylist(playlist.ID)
+	if err != nil {
+		return err
+	}
+	s.showPlayback(playback)
+	s.renderer.Message("Playing playlist: " + playlist.Name)
+	return nil
+}
+
+// playlists returns the user's playlists, fetching them unless already listed
+func (s *session) playlists() (spotify.Playlists, error) {
+	if len(s.lastPlaylists.Items) > 0 {
+		return s.lastPlaylists, nil
+	}
+	results, err := s.client.ListPlaylists()
+	if err != nil {
+		return results, err
+	}
+	s.lastPlaylists = results
+	return results, nil
+}
+
+func cmdVolume(s *session, args []string, flags flagValues) error {
+	vol, err := strconv.Atoi(args[0])
+	if err != nil {
+		return usageError(fmt.Sprintf("Invalid percent: %s is not a number", args[0]))
+	}
+	s.stopFade()
+
+	// +n and -n change the volume relative to the current one
+	if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+		if vol, err = s.client.ChangeVolume(vol); err != nil {
+			return err
+		}
+		s.renderer.Message(fmt.Sprintf("Volume set to %d%%", vol))
+		return nil
+	}
+
+	if vol < 0 || vol > 100 {
+		return usageError(fmt.Sprintf("Invalid volume: %s. Use a volume between 0 and 100", args[0]))
+	}
+	if err := s.client.SetVolume(vol); err != nil {
+		return err
+	}
+	s.renderer.Message(fmt.Sprintf("Volume set to %d%%", vol))
+	return nil
+}
+
+// unmuteVolume is restored by unmute when the volume before mute is unknown
+const unmuteVolume = 50
+
+func cmdMute(s *session, args []string, flags flagValues) error {
+	s.stopFade()
+	vol, err := s.client.GetVolume()
+	if err != nil {
+		return err
+	}
+	if vol == 0 {
+		s.renderer.Message("Already muted")
+		return nil
+	}
+
+	// The volume is kept in the config file, so unmute also works in a later run
+	if err := updateConfig(func(config *spotify.Config) { config.MutedVolume = vol }); err != nil {
+		return err
+	}
+	if err := s.client.SetVolume(0); err != nil {
+		return err
+	}
+	s.renderer.Message(fmt.Sprintf("Muted, volume was %d%%", vol))
+	return nil
+}
+
+func cmdUnmute(s *session, args []string, flags flagValues) error {
+	s.stopFade()
+	vol, err := s.client.GetVolume()
+	if err != nil {
+		return err
+	}
+	if vol > 0 {
+		s.renderer.Message("Not muted")
+		return nil
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	restore := config.MutedVolume
+	if restore == 0 {
+		restore = unmuteVolume
+	}
+
+	if err := s.client.SetVolume(restore); err != nil {
+		return err
+	}
+	// The volume is only forgotten once it has been restored
+	if err := updateConfig(func(config *spotify.Config) { config.MutedVolume = 0 }); err != nil {
+		return err
+	}
+	s.renderer.Message(fmt.Sprintf("Volume set to %d%%", restore))
+	return nil
+}
+
+func cmdFade(s *session, args []string, flags flagValues) error {
+	if strings.EqualFold(args[0], "stop") {
+		if len(args) > 1 {
+			return usageError("fade stop does not take a duration")
+		}
+		if !s.fade.running() {
+			return usageError("No fade is running")
+		}
+		s.stopFade()
+		s.renderer.Message("Fade stopped")
+		return nil
+	}
+
+	target, err := strconv.Atoi(args[0])
+	if err != nil || target < 0 || target > 100 {
+		return usageError(fmt.Sprintf("Invalid percent: %s. Use a volume between 0 and 100", args[0]))
+	}
+	if len(args) < 2 {
+		return usageError("Missing duration. Usage: fade <percent|stop> [duration]")
+	}
+	ms, err := spotify.ParseTime(args[1])
+	if err != nil {
+		return usageError(fmt.Sprintf("Invalid duration: %s. Use a time such as 30s, 2m or 1:30", args[1]))
+	}
+	duration := time.Duration(ms) * time.Millisecond
+	s.stopFade()
+
+	// A single command fades in the foreground until it is done or interrupted
+	if s.prompt == nil {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		s.renderer.Message(fmt.Sprintf("Fading to %d%% over %s. Press Ctrl-C to stop", target, spotify.FormatTime(ms)))
+		vol, err := s.client.Fade(ctx, target, duration)
+		if errors.Is(err, context.Canceled) {
+			s.renderer.Message(fmt.Sprintf("Fade stopped at %d%%", vol))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.renderer.Message(fmt.Sprintf("Volume set to %d%%", vol))
+		return nil
+	}
+
+	// The interactive loop keeps taking commands while the volume changes
+	s.fade = s.startJob(duration, func(ctx context.Context) error {
+		_, err := s.client.Fade(ctx, target, duration)
+		return err
+	})
+	s.renderer.Message(fmt.Sprintf("Fading to %d%% over %s. Use 'fade stop' to stop", target, spotify.FormatTime(ms)))
+	return nil
+}
+
+func cmdSleep(s *session, args []string, flags flagValues) error {
+	endOfTrack, endOfAlbum := flags["end-of-track"] != "", flags["end-of-album"] != ""
+
+	if len(args) > 0 && strings.EqualFold(args[0], "cancel") {
+		if endOfTrack || endOfAlbum || flags["fade"] != "" {
+			return usageError("sleep cancel does not take flags")
+		}
+		if !s.sleep.running() {
+			return usageError("No sleep timer is running")
+		}
+		s.sleep.stop()
+		s.sleep = nil
+		s.renderer.Message("Sleep timer cancelled")
+		return nil
+	}
+
+	var given int
+	for _, set := range []bool{len(args) > 0, endOfTrack, endOfAlbum} {
+		if set {
+			given++
+		}
+	}
+	if given > 1 {
+		return usageError("Give either a duration, --end-of-track or --end-of-album")
+	}
+	if given == 0 {
+		if flags["fade"] != "" {
+			return usageError("Missing duration. Usage: sleep [flags] [duration|cancel]")
+		}
+		if !s.sleep.running() {
+			s.renderer.Message("No sleep timer")
+			return nil
+		}
+		left := time.Until(s.sleep.ends).Round(time.Second)
+		s.renderer.Message("Sleep timer: pausing in " + spotify.FormatTime(int(left.Milliseconds())))
+		return nil
+	}
+
+	var duration time.Duration
+	switch {
+	case endOfTrack:
+		left, err := s.client.TrackTimeLeft()
+		if err != nil {
+			return err
+		}
+		duration = left
+	case endOfAlbum:
+		left, err := s.client.AlbumTimeLeft()
+		if err != nil {
+			return err
+		}
+		duration = left
+	default:
+		ms, err := spotify.ParseTime(args[0])
+		if err != nil || ms == 0 {
+			return usageError(fmt.Sprintf("Invalid duration: %s. Use a time such as 30m, 1h or 45:00", args[0]))
+		}
+		duration = time.Duration(ms) * time.Millisecond
+	}
+
+	var fade time.Duration
+	message := "Sleep timer: pausing in " + spotify.FormatTime(int(duration.Round(time.Second).Milliseconds()))
+	if flags["fade"] != "" {
+		fade = spotify.SleepFade
+		message += " after fading out"
+	}
+
+	// A single command waits in the foreground, e.g. started with & in a shell,
+	// until the timer ends or it is interrupted or killed
+	if s.prompt == nil {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		s.renderer.Message(message)
+		err := s.client.Sleep(ctx, duration, fade)
+		if errors.Is(err, context.Canceled) {
+			s.renderer.Message("Sleep timer cancelled")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.renderer.Message("Playback paused")
+		return nil
+	}
+
+	// A new timer replaces the running one, and fading out stops a fade
+	s.sleep.stop()
+	if fade > 0 {
+		s.stopFade()
+	}
+	s.sleep = s.startJob(duration, func(ctx context.Context) error {
+		return s.client.Sleep(ctx, duration, fade)
+	})
+	s.renderer.Message(message + ". Use 'sleep cancel' to cancel")
+	return nil
+}
+
+// stopFade stops the fade running in the background, if any, and waits until
+// it no longer changes the volume
+func (s *session) stopFade() {
+	s.fade.stop()
+	s.fade = nil
+}
+
+// stopJobs stops the fade and the sleep timer running in the background
+func (s *session) stopJobs() {
+	s.stopFade()
+	s.sleep.stop()
+	s.sleep = nil
+}
+
+// maxJobErrors is the number of job errors kept until the next prompt; more
+// are dropped rather than blocking the job
+const maxJobErrors = 8
+
+// startJob runs job in the background until it returns or is stopped; d is
+// how long it is expected to run. Errors other than being stopped are queued
+// for reportJobErrors, as the line editor owns the terminal while it runs.
+func (s *session) startJob(d time.Duration, job func(ctx context.Context) error) *backgroundJob {
+	if s.jobErrors == nil {
+		s.jobErrors = make(chan error, maxJobErrors)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &backgroundJob{cancel: cancel, done: make(chan struct{}), ends: time.Now().Add(d)}
+	go func(errs chan<- error) {
+		defer close(j.done)
+		if err := job(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+	}(s.jobErrors)
+	return j
+}
+
+// reportJobErrors reports the errors of the background jobs that failed since
+// it was last called
+func (s *session) reportJobErrors() {
+	for {
+		select {
+		case err := <-s.jobErrors:
+			s.reportError(err)
+		default:
+			return
+		}
+	}
+}
+
+// stop stops the job, if any, and waits until it has returned
+func (j *backgroundJob) stop() {
+	if j == nil {
+		return
+	}
+	j.cancel()
+	<-j.done
+}
+
+// running reports whether the job has not returned yet
+func (j *backgroundJob) running() bool {
+	if j == nil {
+		return false
+	}
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func cmdShuffle(s *session, args []string, flags flagValues) error {
+	if len(args) == 0 {
+		state, err := s.client.GetPlaybackState()
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			return spotify.ErrNoActiveDevice
+		}
+		s.renderer.Shuffle(state.ShuffleState)
+		return nil
+	}
+
+	var state *spotify.PlaybackState
+	var err error
+	switch strings.ToLower(args[0]) {
+	case "on":
+		state, err = s.client.SetShuffle(true)
+	case "off":
+		state, err = s.client.SetShuffle(false)
+	case "toggle":
+		state, err = s.client.ToggleShuffle()
+	default:
+		return usageError(fmt.Sprintf("Invalid shuffle mode: %s. Valid modes are: %s", args[0], strings.Join(shuffleModes, ", ")))
+	}
+	if err != nil {
+		return err
+	}
+	s.renderer.Shuffle(state.ShuffleState)
+	return nil
+}
+
+func cmdRepeat(s *session, args []string, flags flagValues) error {
+	mode, err := s.client.ToggleRepeat()
+	if err != nil {
+		return err
+	}
+	s.renderer.RepeatModeSet(mode)
+	return nil
+}
+
+func cmdRepeatMode(s *session, args []string, flags flagValues) error {
+	if len(args) == 0 {
+		mode, err := s.client.GetRepeatMode()
+		if err != nil {
+			return err
+		}
+		s.renderer.RepeatMode(mode)
+		return nil
+	}
+
+	mode, err := s.client.SetRepeatMode(args[0])
+	if err != nil {
+		return err
+	}
+	s.renderer.RepeatModeSet(mode)
+	return nil
+}
+
+func cmdSeek(s *session, args []string, flags flagValues) error {
+	target, err := spotify.ParseSeekTarget(args[0])
+	if err != nil {
+		return usageError("Invalid position: " + err.Error())
+	}
+	state, err := s.client.Seek(target)
+	if err != nil {
+		return err
+	}
+	s.renderer.Message(fmt.Sprintf("Position: %s / %s", spotify.FormatTime(state.ProgressMs), spotify.FormatTime(state.Item.Duration)))
+	return nil
+}
+
+func cmdNext(s *session, args []string, flags flagValues) error {
+	if err := s.client.SkipToNext(); err != nil {
+		return err
+	}
+	s.renderer.Message("Skipped to next track")
+	return nil
+}
+
+func cmdPrev(s *session, args []string, flags flagValues) error {
+	if err := s.client.SkipToPrevious(); err != nil {
+		return err
+	}
+	s.renderer.Message("Skipped to previous track")
+	return nil
+}
+
+func cmdDevices(s *session, args []string, flags flagValues) error {
+	devices, err := s.client.GetDevices()
+	if err != nil {
+		return err
+	}
+	s.lastDevices = devices
+	s.renderer.Devices(devices)
+	return nil
+}
+
+func cmdDevice(s *session, args []string, flags flagValues) error {
+	if flags["clear"] != "" {
+		if len(args) > 0 {
+			return usageError("--clear does not take a device")
+		}
+		if err := saveDefaultDevice(""); err != nil {
+			return err
+		}
+		s.client.Device, s.client.DefaultDevice = "", ""
+		s.renderer.Message("Playing on the active device")
+		return nil
+	}
+
+	if len(args) == 0 {
+		switch {
+		case s.client.Device != "":
+			device, err := s.findDevice(s.client.Device)
+			if err != nil {
+				return err
+			}
+			s.renderer.Message("Playing on " + device.Name)
+		case s.client.DefaultDevice != "":
+			s.renderer.Message(fmt.Sprintf("Playing on %s when it is available, else on the active device", s.client.DefaultDevice))
+		default:
+			s.renderer.Message("Playing on the active device")
+		}
+		return nil
+	}
+
+	device, err := s.findDevice(args[0])
+	if err != nil {
+		return err
+	}
+	if device.IsRestricted {
+		return usageError(fmt.Sprintf("%s does not accept remote control", device.Name))
+	}
+	if flags["save"] != "" {
+		if err := saveDefaultDevice(device.Name); err != nil {
+			return err
+		}
+		s.client.DefaultDevice = device.Name
+	}
+	s.client.Device = device.ID
+	s.renderer.Message("Playing on " + device.Name)
+	return nil
+}
+
+func cmdTransfer(s *session, args []string, flags flagValues) error {
+	device, err := s.findDevice(args[0])
+	if err != nil {
+		return err
+	}
+	if device.IsRestricted {
+		return usageError(fmt.Sprintf("%s does not accept remote control", device.Name))
+	}
+
+	state, err := s.client.TransferPlayback(device, flags["play"] != "")
+	if err != nil {
+		return err
+	}
+	// A selected device would take playback back on the next play command
+	if s.client.Device != "" {
+		s.client.Device = state.Device.ID
+	}
+
+	status := "paused"
+	if state.IsPlaying {
+		status = "playing"
+	}
+	s.renderer.Message(fmt.Sprintf("Now %s on %s (%s)", status, state.Device.Name, state.Device.Type))
+	return nil
+}
+
+// findDevice returns the device with the given number in the last devices
+// listing, or with the given ID or name
+func (s *session) findDevice(arg string) (spotify.Device, error) {
+	if num, err := strconv.Atoi(arg); err == nil {
+		if num < 1 || num > len(s.lastDevices) {
+			return spotify.Device{}, usageError("Invalid device number")
+		}
+		return s.lastDevices[num-1], nil
+	}
+
+	devices, err := s.client.GetDevices()
+	if err != nil {
+		return spotify.Device{}, err
+	}
+	device, err := spotify.FindDevice(devices, arg)
+	if err != nil {
+		return spotify.Device{}, usageError(err.Error())
+	}
+	return device, nil
+}
+
+// saveDefaultDevice stores the name of the default device in the config file;
+// an empty name removes it
+func saveDefaultDevice(name string) error {
+	return updateConfig(func(config *spotify.Config) { config.DefaultDevice = name })
+}
+
+// loadConfig reads the config file
+func loadConfig() (spotify.Config, error) {
+	path, err := spotify.ConfigPath()
+	if err != nil {
+		return spotify.Config{}, err
+	}
+	return spotify.LoadConfig(path)
+}
+
+// updateConfig applies change to the config file
+func updateConfig(change func(config *spotify.Config)) error {
+	path, err := spotify.ConfigPath()
+	if err != nil {
+		return err
+	}
+	config, err := spotify.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	change(&config)
+	return config.Save(path)
+}
+
+func cmdHelp(s *session, args []string, flags flagValues) error {
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	return printHelp(s.out, name)
+}
+
+func cmdQuit(s *session, args []string, flags flagValues) error {
+	return errQuit
+}
+
+// reportError shows usage errors on the console and failed requests through the renderer
+func (s *session) reportError(err error) {
+	var usage usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintln(s.console, usage)
+		return
+	}
+	s.renderer.Error(err)
+}
+
+// exitCode maps the result of a command to the exit code of the subcommand mode
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil, errors.Is(err, errQuit):
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, spotify.ErrNoActiveDevice):
+		return exitNoDevice
+	}
+	return exitFailure
+}
+
+// parseArgs separates the global flags from the command words, so they may follow
+// the subcommand as in "current --output json". Other flags are left to the
+// command, and "--" and the words after it are passed on untouched. It returns
+// flag.ErrHelp, with the command words read so far, for -h or --help.
+func parseArgs(args []string) (output string, command []string, err error) {
+	output = spotify.OutputBox
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			if len(command) == 0 {
+				return output, args[i+1:], nil
+			}
+			return output, append(command, args[i:]...), nil
+		case arg == "-h" || arg == "--help":
+			return output, command, flag.ErrHelp
+		case arg == "-o" || arg == "--output":
+			if i+1 >= len(args) {
+				return "", nil, usageError("flag needs an argument: " + arg)
+			}
+			i++
+			output = args[i]
+		case strings.HasPrefix(arg, "-o=") || strings.HasPrefix(arg, "--output="):
+			_, output, _ = strings.Cut(arg, "=")
+		default:
+			command = append(command, arg)
+		}
+	}
+	return output, command, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// complete returns the completions of the word before the cursor in the interactive
+// loop, quoted for the tokenizer
+func (s *session) complete(head string) ([]string, int) {
+	words, start := splitHead(head)
+
+	var candidates []string
+	for _, value := range filterPrefix(s.completeWords(words), unquote(head[start:])) {
+		candidates = append(candidates, quote(value))
+	}
+	return candidates, start
+}
+
+// completeWords returns the values for the word following words: command names,
+// then the flags of the command and the values of its flags and arguments
+func (s *session) completeWords(words []string) []string {
+	if len(words) == 0 {
+		var names []string
+		for _, cmd := range registry {
+			if !cmd.hidden {
+				names = append(names, cmd.name)
+				names = append(names, cmd.aliases...)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	cmd := lookupCommand(words[0])
+	if cmd == nil {
+		return nil
+	}
+
+	// Count the arguments before the cursor, skipping flags and their values
+	index := 0
+	literal := false
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case literal:
+			index++
+		case word == "--":
+			literal = true
+		case strings.HasPrefix(word, "--"):
+			spec, ok := cmd.flag(word[2:])
+			if ok && spec.value != "" {
+				if i == len(words)-1 {
+					return spec.completions(s)
+				}
+				i++
+			}
+		default:
+			index++
+		}
+	}
+
+	values := s.argValues(cmd, index)
+	if !literal {
+		for _, spec := range cmd.flags {
+			values = append(values, "--"+spec.name)
+		}
+	}
+	return values
+}
+
+// filterPrefix returns the values starting with prefix, ignoring case
+func filterPrefix(values []string, prefix string) []string {
+	var matches []string
+	for _, value := range values {
+		if strings.HasPrefix(strings.ToLower(value), strings.ToLower(prefix)) {
+			matches = append(matches, value)
+		}
+	}
+	return matches
+}
+
+// argValues returns the values accepted by argument index of a command
+func (s *session) argValues(cmd *command, index int) []string {
+	if len(cmd.args) == 0 {
+		return nil
+	}
+	if index >= len(cmd.args) {
+		// Only a trailing rest argument takes more than one word
+		if kind := cmd.args[len(cmd.args)-1].kind; kind != argRest && kind != argWords {
+			return nil
+		}
+		index = len(cmd.args) - 1
+	}
+
+	spec := cmd.args[index]
+	if spec.complete != nil {
+		return spec.complete(s)
+	}
+	return spec.values
+}
+
+// completions returns the values accepted by a flag
+func (spec flagSpec) completions(s *session) []string {
+	if spec.complete != nil {
+		return spec.complete(s)
+	}
+	return spec.values
+}
+
+// splitHead splits the text before the cursor into the complete words and the
+// byte offset where the word being typed starts. Unlike tokenize it accepts an
+// unterminated quote, which belongs to the word being typed.
+func splitHead(head string) (words []string, start int) {
+	var word strings.Builder
+	inWord := false
+	var quoteChar byte
+
+	for i := 0; i < len(head); i++ {
+		c, pos := head[i], i
+		switch {
+		case quoteChar != 0 && c == quoteChar:
+			quoteChar = 0
+		case c == '\\' && quoteChar != '\'' && i+1 < len(head):
+			i++
+			word.WriteByte(head[i])
+		case quoteChar != 0:
+			word.WriteByte(c)
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\'' || c == '"':
+			quoteChar = c
+		default:
+			word.WriteByte(c)
+		}
+		if !inWord {
+			inWord = true
+			start = pos
+		}
+	}
+	if !inWord {
+		start = len(head)
+	}
+	return words, start
+}
+
+// unquote returns the value of a partially typed word
+func unquote(word string) string {
+	// Close a quote that is still open
+	for _, closing := range []string{"", `"`, "'"} {
+		if words, err := tokenize(word + closing); err == nil && len(words) > 0 {
+			return words[0]
+		}
+	}
+	return ""
+}
+
+// quote returns value as a single word for the tokenizer
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t'\"\\") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// indices returns the numbers 1 to n
+func indices(n int) []string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = strconv.Itoa(i + 1)
+	}
+	return values
+}
+
+func completeSearchResults(s *session) []string {
+	return indices(len(s.lastSearchResults.Items()))
+}
+
+func completeNewReleases(s *session) []string {
+	return indices(len(s.lastNewReleases.Albums))
+}
+
+// completePlaylists returns the listed numbers and the names of the user's playlists
+func completePlaylists(s *session) []string {
+	playlists, err := s.playlists()
+	if err != nil {
+		return nil
+	}
+	values := indices(len(playlists.Items))
+	for _, playlist := range playlists.Items {
+		values = append(values, playlist.Name)
+	}
+	return values
+}
+
+// completeDevices returns the listed numbers and the names of the available devices
+func completeDevices(s *session) []string {
+	values := indices(len(s.lastDevices))
+	devices, err := s.client.GetDevices()
+	if err != nil {
+		return values
+	}
+	for _, device := range devices {
+		values = append(values, device.Name)
+	}
+	return values
+}
+
+func completeCommands(s *session) []string {
+	return s.completeWords(nil)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	spotify "spotify-cli/src"
+)
+
+// programName is the command the completion scripts complete and call back
+const programName = "spotify-cli"
+
+// completionScripts are the shell scripts printed by the completion command.
+// They ask the hidden __complete command for the candidates of the current word.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for spotify-cli
+# Load with: source <(spotify-cli completion bash)
+
+_spotify_cli() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local candidate
+    COMPREPLY=()
+    while IFS= read -r candidate; do
+        COMPREPLY+=("$(printf '%q' "$candidate")")
+    done < <(spotify-cli __complete -- "${COMP_WORDS[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null)
+}
+
+complete -F _spotify_cli spotify-cli
+`,
+	"zsh": `#compdef spotify-cli
+# zsh completion for spotify-cli
+# Load with: source <(spotify-cli completion zsh), or save as _spotify-cli in $fpath
+
+_spotify_cli() {
+    local output
+    output=$(spotify-cli __complete -- "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null)
+    [[ -z $output ]] && return 1
+    local -a candidates
+    candidates=("${(@f)output}")
+    compadd -U -a candidates
+}
+
+if [[ $funcstack[1] == _spotify_cli ]]; then
+    _spotify_cli "$@"
+else
+    compdef _spotify_cli spotify-cli
+fi
+`,
+	"fish": `# fish completion for spotify-cli
+# Load with: spotify-cli completion fish | source
+
+function __spotify_cli_complete
+    set -l words (commandline -opc)
+    set -e words[1]
+    spotify-cli __complete -- $words (commandline -ct) 2>/dev/null
+end
+
+complete -c spotify-cli -f -a '(__spotify_cli_complete)'
+`,
+}
+
+// completionShells lists the shells with a completion script
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func cmdCompletion(s *session, args []string, flags flagValues) error {
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return usageError(fmt.Sprintf("Unsupported shell: %s. Supported shells are: %s", args[0], strings.Join(completionShells, ", ")))
+	}
+	fmt.Fprint(s.out, script)
+	return nil
+}
+
+// outputFormats are the --output values offered by shell completion
+var outputFormats = []string{spotify.OutputBox, spotify.OutputJSON, spotify.OutputNDJSON, spotify.OutputTSV, spotify.OutputTemplate}
+
+// cmdComplete prints the candidates for the last of the given words, one per
+// line, for the shell completion scripts
+func cmdComplete(s *session, args []string, flags flagValues) error {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	words, partial := args[:len(args)-1], unquote(args[len(args)-1])
+
+	// Complete the value of --output, and leave the global flags out of the command words
+	var command []string
+	for i := 0; i < len(words); i++ {
+		switch word := words[i]; {
+		case (word == "--output" || word == "-o") && i == len(words)-1:
+			printCandidates(s, outputFormats, partial)
+			return nil
+		case word == "--output" || word == "-o":
+			i++
+		case strings.HasPrefix(word, "--output=") || strings.HasPrefix(word, "-o="):
+		default:
+			command = append(command, word)
+		}
+	}
+
+	printCandidates(s, s.completeWords(command), partial)
+	return nil
+}
+
+// printCandidates prints the values starting with partial
+func printCandidates(s *session, values []string, partial string) {
+	for _, value := range filterPrefix(values, partial) {
+		fmt.Fprintln(s.out, value)
+	}
+}
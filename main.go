@@ -2,20 +2,19 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-	
-	spotify "spotify-cli/src" // Import the spotify package
-)
+	"time"
 
-// Global variables to store search results
-var (
-	lastSearchResults spotify.SearchResults
-	lastNewReleases   spotify.NewReleases
-	lastPlaylists     spotify.Playlists
+	spotify "spotify-cli/src" // Import the spotify package
+	"spotify-cli/src/lineedit"
 )
 
 func loadEnv(filename string) error {
@@ -47,261 +46,203 @@ func NewSpotifyClient() (*spotify.SpotifyClient, error) {
 	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
 	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
 
-	if clientID == "" || clientSecret == "" {
-		return nil, fmt.Errorf("SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET must be set in .env file")
+	// SPOTIFY_AUTH_MODE selects between the client secret flow (default) and PKCE
+	var usePKCE bool
+	switch mode := strings.ToLower(os.Getenv("SPOTIFY_AUTH_MODE")); mode {
+	case "", "secret":
+		usePKCE = false
+	case "pkce":
+		usePKCE = true
+	default:
+		return nil, fmt.Errorf("invalid SPOTIFY_AUTH_MODE: %s. Valid modes are: secret, pkce", mode)
+	}
+
+	if clientID == "" {
+		return nil, fmt.Errorf("SPOTIFY_CLIENT_ID must be set in .env file")
+	}
+	if !usePKCE && clientSecret == "" {
+		return nil, fmt.Errorf("SPOTIFY_CLIENT_SECRET must be set in .env file, or set SPOTIFY_AUTH_MODE=pkce")
+	}
+
+	tokenStore, err := spotify.DefaultTokenStore()
+	if err != nil {
+		return nil, err
+	}
+
+	// Optional retry settings for rate-limited requests
+	var retry spotify.RetryPolicy
+	if value := os.Getenv("SPOTIFY_RETRY_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return nil, fmt.Errorf("invalid SPOTIFY_RETRY_MAX_ATTEMPTS: %s", value)
+		}
+		retry.MaxAttempts = attempts
+	}
+	if value := os.Getenv("SPOTIFY_RETRY_DEADLINE"); value != "" {
+		deadline, err := time.ParseDuration(value)
+		if err != nil || deadline <= 0 {
+			return nil, fmt.Errorf("invalid SPOTIFY_RETRY_DEADLINE: %s", value)
+		}
+		retry.Deadline = deadline
 	}
 
 	return &spotify.SpotifyClient{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
+		UsePKCE:      usePKCE,
+		TokenStore:   tokenStore,
+		Retry:        retry,
+		// Optional overrides for a local stand-in or recording proxy
+		APIBaseURL:      os.Getenv("SPOTIFY_API_BASE_URL"),
+		AccountsBaseURL: os.Getenv("SPOTIFY_ACCOUNTS_BASE_URL"),
 	}, nil
 }
 
+const usage = `Usage: spotify-cli [--output format] [command [arguments]]
+
+Without a command, spotify-cli starts an interactive session. With a command,
+such as "spotify-cli next" or "spotify-cli search daft punk", it runs that
+command once and exits with status 0 on success, 1 when the request failed,
+2 on invalid usage and 3 when there is no active device.
+
+Output formats: box (default), json, ndjson, tsv, template=<Go template>
+`
+
 func main() {
+	output, command, err := parseArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		if len(command) > 0 && printHelp(os.Stdout, command[0]) == nil {
+			return
+		}
+		fmt.Print(usage)
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+
+	renderer, err := spotify.NewRenderer(output, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	// Keep stdout for results when another program reads them
+	interactive := len(command) == 0
+	console := io.Writer(os.Stdout)
+	if output != spotify.OutputBox || !interactive {
+		console = os.Stderr
+	}
+
 	// Load environment variables
 	if err := loadEnv(".env"); err != nil {
 		log.Fatal("Error loading .env file:", err)
 	}
 
+	// Commands such as help and completion work without signing in
+	offline := false
+	if !interactive {
+		if cmd := lookupCommand(command[0]); cmd != nil {
+			offline = cmd.offline
+		}
+	}
+
 	// Create Spotify client
 	client, err := NewSpotifyClient()
-	if err != nil {
+	if err != nil && !offline {
 		log.Fatal("Error creating Spotify client:", err)
 	}
+	if err != nil {
+		client = &spotify.SpotifyClient{}
+	}
+	// Authorization prompts and warnings stay off stdout when results go there
+	client.Console = console
+
+	// Play on the saved default device when it is available
+	if path, err := spotify.ConfigPath(); err == nil {
+		config, err := spotify.LoadConfig(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: Could not load config:", err)
+		}
+		client.DefaultDevice = config.DefaultDevice
+	}
 
 	// Start the authorization flow
-	fmt.Println("Starting Spotify CLI...")
-	if err := client.StartAuthFlow(); err != nil {
+	if interactive {
+		fmt.Fprintln(console, "Starting Spotify CLI...")
+	}
+	if offline {
+		// Use a saved session if there is one, e.g. to complete playlist names
+		client.ResumeSession()
+	} else if err := client.StartAuthFlow(); err != nil {
 		log.Fatal("Error during authorization:", err)
 	}
 
-	fmt.Println("Successfully authenticated with Spotify!")
+	s := &session{client: client, renderer: renderer, out: os.Stdout, console: console}
 
-	// Start command loop
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Println("\nCommands:")
-		fmt.Println("1. search <query> - Search for tracks")
-		fmt.Println("2. play <number> - Play track from search results")
-		fmt.Println("3. new - Show new releases")
-		fmt.Println("4. play-new <number> - Play album from new releases")
-		fmt.Println("5. current - Show current track")
-		fmt.Println("6. toggle - Play/Pause")
-		fmt.Println("7. playlists - List all playlists")
-		fmt.Println("8. play-list <number> - Play playlist from list")
-		fmt.Println("9. volume <0-100> - Set playback volume")
-		fmt.Println("10. repeat - Toggle repeat mode (off/track/context)")
-		fmt.Println("11. repeat-mode <mode> - Set repeat mode (off/track/context/song/album/playlist)")
-		fmt.Println("12. next - Skip to next track")
-		fmt.Println("13. prev - Go back to previous track")
-		fmt.Println("14. quit - Exit the program")
-		fmt.Print("\nEnter command: ")
+	if !interactive {
+		// Run a single command, e.g. from a key binding or a script
+		err := runCommand(s, command)
+		if err != nil && !errors.Is(err, errQuit) {
+			s.reportError(err)
+		}
+		os.Exit(exitCode(err))
+	}
 
-		command, _ := reader.ReadString('\n')
-		command = strings.TrimSpace(command)
+	fmt.Fprintln(console, "Successfully authenticated with Spotify!")
 
-		switch {
-		case command == "quit":
-			fmt.Println("Goodbye!")
-			return
-		case command == "new":
-			results, err := client.ShowNewReleases()
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					results, err = client.ShowNewReleases()
-					if err != nil {
-						fmt.Println("Error after token refresh:", err)
-						continue
-					}
-					// If successful after token refresh, update lastNewReleases
-					lastNewReleases = results
-					continue
-				}
-				continue
-			}
-			lastNewReleases = results
-		case command == "current":
-			err = client.GetCurrentTrack()
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.GetCurrentTrack(); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case command == "toggle":
-			err = client.TogglePlayback()
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.TogglePlayback(); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case command == "playlists":
-			results, err := client.ListPlaylists()
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					results, err = client.ListPlaylists()
-					if err != nil {
-						fmt.Println("Error after token refresh:", err)
-						continue
-					}
-					// If successful after token refresh, update lastPlaylists
-					lastPlaylists = results
-					continue
-				}
-				continue
-			}
-			lastPlaylists = results
-		case strings.HasPrefix(command, "play "):
-			numStr := strings.TrimPrefix(command, "play ")
-			num, err := strconv.Atoi(numStr)
-			if err != nil || num < 1 || num > len(lastSearchResults.Tracks) {
-				fmt.Println("Invalid track number")
-				continue
-			}
+	// Start command loop with line editing, history and completion
+	editor := lineedit.New(os.Stdin, console)
+	editor.Complete = s.complete
+	if dir, err := spotify.StateDir(); err == nil {
+		history, err := lineedit.LoadHistory(filepath.Join(dir, "history"))
+		if err != nil {
+			fmt.Fprintln(console, "Warning: Could not load command history:", err)
+		}
+		editor.History = history
+	}
+	runCommandLoop(s, editor)
+}
 
-			track := lastSearchResults.Tracks[num-1]
-			err = client.PlayTrack(track.URI)
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.PlayTrack(track.URI); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case strings.HasPrefix(command, "play-new "):
-			numStr := strings.TrimPrefix(command, "play-new ")
-			num, err := strconv.Atoi(numStr)
-			if err != nil || num < 1 || num > len(lastNewReleases.Albums) {
-				fmt.Println("Invalid album number")
-				continue
-			}
+// lineReader reads the lines of the interactive loop
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
 
-			album := lastNewReleases.Albums[num-1]
-			err = client.PlayAlbum(album.ID)
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.PlayAlbum(album.ID); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case strings.HasPrefix(command, "play-list "):
-			numStr := strings.TrimPrefix(command, "play-list ")
-			num, err := strconv.Atoi(numStr)
-			if err != nil || num < 1 || num > len(lastPlaylists.Items) {
-				fmt.Println("Invalid playlist number")
-				continue
-			}
+// runCommandLoop reads and executes commands until quit or end of input.
+// Results go to the renderer; the prompt and usage errors go to the console.
+// A fade or sleep timer still running at the end is stopped. Errors of jobs
+// running in the background are reported before the next prompt.
+func runCommandLoop(s *session, reader lineReader) {
+	s.prompt = reader
+	defer s.reportJobErrors()
+	defer s.stopJobs()
+	printHelp(s.console, "")
+	for {
+		s.reportJobErrors()
+		fmt.Fprintln(s.console)
+		line, err := reader.ReadLine("Enter command: ")
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			continue
+		}
+		if err != nil {
+			// End of input, e.g. when commands are piped in
+			fmt.Fprintln(s.console)
+			return
+		}
 
-			playlist := lastPlaylists.Items[num-1]
-			err = client.PlayPlaylist(playlist.ID)
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.PlayPlaylist(playlist.ID); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case strings.HasPrefix(command, "volume "):
-			volStr := strings.TrimPrefix(command, "volume ")
-			vol, err := strconv.Atoi(strings.TrimSpace(volStr))
-			if err != nil {
-				fmt.Println("Error: Please provide a valid volume number between 0 and 100")
-				continue
-			}
-			err = client.SetVolume(vol)
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.SetVolume(vol); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case strings.HasPrefix(command, "search "):
-			query := strings.TrimPrefix(command, "search ")
-			results, err := client.SearchTracks(query)
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					results, err = client.SearchTracks(query)
-					if err != nil {
-						fmt.Println("Error after token refresh:", err)
-						continue
-					}
-					// If successful after token refresh, update lastSearchResults
-					lastSearchResults = results
-					continue
-				}
-				continue
-			}
-			lastSearchResults = results
-		case command == "repeat":
-			err = client.ToggleRepeat()
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.ToggleRepeat(); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case strings.HasPrefix(command, "repeat-mode "):
-			mode := strings.TrimPrefix(command, "repeat-mode ")
-			err = client.SetRepeatMode(mode)
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.SetRepeatMode(mode); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case command == "next":
-			err = client.SkipToNext()
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.SkipToNext(); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		case command == "prev":
-			err = client.SkipToPrevious()
-			if err != nil {
-				fmt.Println("Error:", err)
-				// Try refreshing the token if it expired
-				if err := client.RefreshToken(); err == nil {
-					if err := client.SkipToPrevious(); err != nil {
-						fmt.Println("Error after token refresh:", err)
-					}
-				}
-			}
-		default:
-			fmt.Println("Unknown command")
+		words, err := tokenize(strings.TrimSpace(line))
+		if err == nil {
+			err = runCommand(s, words)
+		}
+		if errors.Is(err, errQuit) {
+			fmt.Fprintln(s.console, "Goodbye!")
+			return
+		}
+		if err != nil {
+			s.reportError(err)
 		}
 	}
 }
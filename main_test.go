@@ -0,0 +1,742 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	spotify "spotify-cli/src"
+	"spotify-cli/src/lineedit"
+	"spotify-cli/src/spotifytest"
+)
+
+// newTestSession starts a fake server and returns a session authenticated against it
+// that renders boxes, help and usage errors into one buffer
+func newTestSession(t *testing.T) (*session, *spotifytest.Server) {
+	t.Helper()
+
+	server := spotifytest.NewServer()
+	t.Cleanup(server.Close)
+
+	client := &spotify.SpotifyClient{
+		ClientID:        spotifytest.ClientID,
+		ClientSecret:    spotifytest.ClientSecret,
+		TokenStore:      spotify.NewMemoryTokenStore(&spotify.Token{RefreshToken: spotifytest.RefreshToken}),
+		APIBaseURL:      server.APIBaseURL(),
+		AccountsBaseURL: server.AccountsBaseURL(),
+	}
+	if err := client.StartAuthFlow(); err != nil {
+		t.Fatalf("StartAuthFlow: %v", err)
+	}
+
+	var out bytes.Buffer
+	return &session{client: client, renderer: spotify.NewBoxRenderer(&out), out: &out, console: &out}, server
+}
+
+// runCommands feeds the commands to the command loop, one per line, and returns the output
+func runCommands(s *session, commands ...string) string {
+	out := s.out.(*bytes.Buffer)
+	out.Reset()
+	input := strings.NewReader(strings.Join(commands, "\n") + "\n")
+	runCommandLoop(s, lineedit.New(input, out))
+	return out.String()
+}
+
+func TestCommandLoopSearchAndPlay(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "search hello", "play 2", "quit")
+	for _, want := range []string{"Hello World", "Hello Goodbye", "Playing track: Hello Again"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	item, ok := server.State().Item()
+	if !ok || item.Name != "Hello Again" {
+		t.Errorf("got item %+v, want Hello Again", item)
+	}
+	if len(s.lastSearchResults.Tracks) != 3 {
+		t.Errorf("got %d stored search results, want 3", len(s.lastSearchResults.Tracks))
+	}
+}
+
+func TestCommandLoopSearchTypes(t *testing.T) {
+	s, server := newTestSession(t)
+
+	// Results are numbered across the groups, so 3 is the first artist after two albums
+	out := runCommands(s, "search --type album,artist stub", "play 3", "quit")
+	for _, want := range []string{"Albums", "Symphony of Stubs", "Artists", "Playing artist: Stub & The Fakes"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if state := server.State(); state.ContextURI != "spotify:artist:artist3" {
+		t.Errorf("got context %q, want artist3", state.ContextURI)
+	}
+
+	if err := runCommand(s, []string{"search", "--type", "podcast", "x"}); exitCode(err) != exitUsage {
+		t.Errorf("invalid type: got %v, want a usage error", err)
+	}
+}
+
+func TestSearchFilterFlags(t *testing.T) {
+	s, _ := newTestSession(t)
+
+	if err := runCommand(s, []string{"search", "--artist", "mock orchestra", "--year=2021", "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if tracks := s.lastSearchResults.Tracks; len(tracks) != 1 || tracks[0].Name != "Hello Again" {
+		t.Errorf("got tracks %+v, want Hello Again", tracks)
+	}
+
+	for _, words := range [][]string{
+		{"search"},
+		{"search", "--year", "nineties", "x"},
+		{"search", "--tag", "new", "--type", "track", "x"},
+		{"search", "--market", "Europe", "x"},
+	} {
+		if err := runCommand(s, words); exitCode(err) != exitUsage {
+			t.Errorf("%q: got %v, want a usage error", words, err)
+		}
+	}
+}
+
+func TestPlayURIs(t *testing.T) {
+	s, server := newTestSession(t)
+
+	tests := []struct {
+		arg     string
+		context string
+		item    string
+	}{
+		{"spotify:track:album2-track3", "", "Finale"},
+		{"https://open.spotify.com/intl-fr/album/album3?si=abc123", "spotify:album:album3", "Pretend"},
+		{"https://open.spotify.com/playlist/playlist2?si=x&pi=y", "spotify:playlist:playlist2", "Overture"},
+		{"spotify:artist:artist1", "spotify:artist:artist1", "Hello World"},
+		{"open.spotify.com/episode/episode2", "", "Mocks and Stubs"},
+	}
+	for _, tt := range tests {
+		if err := runCommand(s, []string{"play", tt.arg}); err != nil {
+			t.Errorf("play %s: %v", tt.arg, err)
+			continue
+		}
+		state := server.State()
+		item, _ := state.Item()
+		if state.ContextURI != tt.context || item.Name != tt.item {
+			t.Errorf("play %s: got context %q and item %q, want %q and %q", tt.arg, state.ContextURI, item.Name, tt.context, tt.item)
+		}
+	}
+
+	if err := runCommand(s, []string{"play", "https://example.com/track/1"}); exitCode(err) != exitUsage {
+		t.Errorf("got %v for a foreign link, want a usage error", err)
+	}
+}
+
+func TestDeviceSelection(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "devices", "device 2", "play spotify:track:album2-track3", "device")
+	for _, want := range []string{"Test Phone (Smartphone) - volume 70%", "Using device: Test Phone", "Playing on Test Phone"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if device, _ := server.State().ActiveDevice(); device.ID != "device2" {
+		t.Errorf("playing on %s, want device2", device.ID)
+	}
+
+	// A saved device is the default of later sessions
+	if err := runCommand(s, []string{"device", "--save", "laptop"}); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := spotify.ConfigPath()
+	if config, err := spotify.LoadConfig(path); err != nil || config.DefaultDevice != "Test Laptop" {
+		t.Errorf("got config %+v, %v; want default device Test Laptop", config, err)
+	}
+	if err := runCommand(s, []string{"device", "--clear"}); err != nil {
+		t.Fatal(err)
+	}
+	if config, _ := spotify.LoadConfig(path); config.DefaultDevice != "" || s.client.Device != "" {
+		t.Errorf("got default %q and device %q after --clear", config.DefaultDevice, s.client.Device)
+	}
+
+	for _, arg := range []string{"Kitchen", "Test", "9"} {
+		if err := runCommand(s, []string{"device", arg}); exitCode(err) != exitUsage {
+			t.Errorf("device %s: got %v, want a usage error", arg, err)
+		}
+	}
+	if values := s.completeWords([]string{"device"}); !slices.Contains(values, "Test Phone") {
+		t.Errorf("device completions %q do not include Test Phone", values)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "transfer --play phne")
+	if !strings.Contains(out, "Now playing on Test Phone (Smartphone)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if state := server.State(); !state.IsPlaying {
+		t.Error("transfer --play did not start playback")
+	}
+	if device, _ := server.State().ActiveDevice(); device.ID != "device2" {
+		t.Errorf("playing on %s, want device2", device.ID)
+	}
+
+	// A selected device follows the transfer
+	s.client.Device = "device2"
+	if err := runCommand(s, []string{"transfer", "laptop"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.client.Device != "device1" {
+		t.Errorf("selected device is %s after the transfer, want device1", s.client.Device)
+	}
+
+	for _, words := range [][]string{{"transfer"}, {"transfer", "test"}, {"transfer", "Kitchen"}} {
+		if err := runCommand(s, words); exitCode(err) != exitUsage {
+			t.Errorf("%s: got %v, want a usage error", strings.Join(words, " "), err)
+		}
+	}
+}
+
+func TestQueueCommand(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "search hello", "queue 2", "queue --all", "new", "queue --new 1", "play-next spotify:episode:episode1", "queue")
+	for _, want := range []string{
+		"Queued track: Hello Again",
+		"Queued 3 items",
+		"Queued 3 tracks of album: Faking It",
+		"Queued episode: spotify:episode:episode1",
+		"Up Next:",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if queued := len(server.State().Queue); queued != 8 {
+		t.Errorf("got %d queued tracks, want 8", queued)
+	}
+
+	for _, words := range [][]string{{"queue", "9"}, {"queue", "--all", "1"}, {"queue", "spotify:nothing:1"}} {
+		if err := runCommand(s, words); exitCode(err) != exitUsage {
+			t.Errorf("%s: got %v, want a usage error", strings.Join(words, " "), err)
+		}
+	}
+	if err := runCommand(s, []string{"queue", "spotify:artist:artist1"}); err == nil {
+		t.Error("queued an artist")
+	}
+	// A partly queued album is told apart from one not queued at all
+	server.FailRequest("POST", "/me/player/queue", 1, http.StatusForbidden)
+	err := runCommand(s, []string{"queue", "--new", "1"})
+	if err == nil || !strings.Contains(err.Error(), "error after queueing 1 tracks of album Faking It") {
+		t.Errorf("got %v, want an error telling 1 track was queued", err)
+	}
+	server.FailRequest("POST", "/me/player/queue", 2, http.StatusForbidden)
+	if err := runCommand(s, []string{"queue", "--all"}); err == nil || !strings.Contains(err.Error(), "error after queueing 2 of 3 items") {
+		t.Errorf("got %v, want an error telling 2 of 3 items were queued", err)
+	}
+}
+
+func TestShuffleCommand(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "shuffle on", "shuffle")
+	if strings.Count(out, "(Random order)") != 2 {
+		t.Errorf("shuffle is not shown as on twice:\n%s", out)
+	}
+	if err := runCommand(s, []string{"shuffle", "toggle"}); err != nil || server.State().Shuffle {
+		t.Errorf("shuffle toggle: %v, shuffle %v", err, server.State().Shuffle)
+	}
+	if err := runCommand(s, []string{"shuffle", "sometimes"}); exitCode(err) != exitUsage {
+		t.Errorf("got %v for an invalid mode, want a usage error", err)
+	}
+
+	out = runCommands(s, "playlists", "play-list --shuffle 2")
+	if !strings.Contains(out, "Playing playlist shuffled: Focus") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if state := server.State(); !state.Shuffle || state.ContextURI != "spotify:playlist:playlist2" {
+		t.Errorf("playing %s with shuffle %v", state.ContextURI, state.Shuffle)
+	}
+
+	runCommands(s, "shuffle off", "new", "play-new --shuffle 1")
+	if state := server.State(); !state.Shuffle || state.ContextURI != "spotify:album:album3" {
+		t.Errorf("playing %s with shuffle %v", state.ContextURI, state.Shuffle)
+	}
+}
+
+func TestSeekCommand(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "seek 1:23", "seek -30s", "seek 50%")
+	for _, want := range []string{"Position: 1:23 / 3:00", "Position: 0:53 / 3:00", "Position: 1:30 / 3:00"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if progress := server.State().ProgressMs; progress != 90000 {
+		t.Errorf("player at %d, want 90000", progress)
+	}
+	if err := runCommand(s, []string{"seek", "soon"}); exitCode(err) != exitUsage {
+		t.Errorf("got %v for an invalid position, want a usage error", err)
+	}
+}
+
+func TestVolumeCommands(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	s, server := newTestSession(t)
+	volume := func() int {
+		device, _ := server.State().ActiveDevice()
+		return device.VolumePercent
+	}
+
+	out := runCommands(s, "volume +10", "volume -100", "volume 40", "mute", "mute")
+	for _, want := range []string{"Volume set to 60%", "Volume set to 0%", "Muted, volume was 40%", "Already muted"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	path, _ := spotify.ConfigPath()
+	if config, _ := spotify.LoadConfig(path); config.MutedVolume != 40 || volume() != 0 {
+		t.Errorf("muted at volume %d, saved %d; want 0 and 40", volume(), config.MutedVolume)
+	}
+
+	// Unmute works from another run
+	s = &session{client: s.client, renderer: s.renderer, out: s.out, console: s.console}
+	out = runCommands(s, "unmute", "unmute")
+	if !strings.Contains(out, "Volume set to 40%") || !strings.Contains(out, "Not muted") || volume() != 40 {
+		t.Errorf("unmuted to volume %d:\n%s", volume(), out)
+	}
+	if config, _ := spotify.LoadConfig(path); config.MutedVolume != 0 {
+		t.Errorf("saved volume %d kept after unmute", config.MutedVolume)
+	}
+
+	// Unmuting what is not muted keeps the saved volume
+	out = runCommands(s, "mute", "volume 20", "unmute")
+	if config, _ := spotify.LoadConfig(path); !strings.Contains(out, "Not muted") || config.MutedVolume != 40 {
+		t.Errorf("saved volume %d after unmuting at 20%%:\n%s", config.MutedVolume, out)
+	}
+
+	// A background fade is stopped by the next volume command
+	out = runCommands(s, "fade 0 10s", "volume 30")
+	if !strings.Contains(out, "Fading to 0% over 0:10") || volume() != 30 || s.fade != nil {
+		t.Errorf("volume %d after stopping the fade:\n%s", volume(), out)
+	}
+
+	// A single command fades in the foreground
+	s.prompt = nil
+	if err := runCommand(s, []string{"fade", "10", "0"}); err != nil || volume() != 10 {
+		t.Errorf("fade 10 0: %v, volume %d", err, volume())
+	}
+
+	// A fade that has finished is no longer running
+	s.fade = s.startJob(0, func(ctx context.Context) error { return nil })
+	<-s.fade.done
+	for _, words := range [][]string{{"volume", "+x"}, {"fade", "101", "1s"}, {"fade", "10"}, {"fade", "10", "soon"}, {"fade", "stop"}} {
+		if err := runCommand(s, words); exitCode(err) != exitUsage {
+			t.Errorf("%s: got %v, want a usage error", strings.Join(words, " "), err)
+		}
+	}
+}
+
+func TestSleepCommand(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "toggle", "sleep --fade 10m", "sleep", "sleep cancel", "sleep", "sleep --end-of-album")
+	for _, want := range []string{
+		"Sleep timer: pausing in 10:00 after fading out. Use 'sleep cancel' to cancel",
+		"Sleep timer cancelled",
+		"No sleep timer",
+		"Sleep timer: pausing in 9:45.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "pausing in 10:00") != 2 {
+		t.Errorf("the timer is not listed:\n%s", out)
+	}
+	if !server.State().IsPlaying {
+		t.Error("playback paused before the timer ended")
+	}
+
+	// A timer that fades out stops a running fade
+	out = runCommands(s, "fade 0 10s", "sleep --fade 10m", "fade stop")
+	if !strings.Contains(out, "No fade is running") {
+		t.Errorf("the fade was not stopped by the sleep timer:\n%s", out)
+	}
+
+	for _, words := range [][]string{{"sleep", "10m", "--end-of-track"}, {"sleep", "soon"}, {"sleep", "0"}, {"sleep", "cancel"}, {"sleep", "--fade"}} {
+		if err := runCommand(s, words); exitCode(err) != exitUsage {
+			t.Errorf("%s: got %v, want a usage error", strings.Join(words, " "), err)
+		}
+	}
+
+	// Errors of background jobs are reported before the next prompt rather than
+	// while it is being read
+	job := s.startJob(0, func(ctx context.Context) error { return errors.New("fade failed") })
+	<-job.done
+	out = runCommands(s, "quit")
+	if i := strings.Index(out, "fade failed"); i < 0 || i > strings.Index(out, "Enter command:") {
+		t.Errorf("the job error is not shown before the prompt:\n%s", out)
+	}
+
+	// A single command waits for the timer
+	s.prompt = nil
+	if err := runCommand(s, []string{"sleep", "0.05"}); err != nil || server.State().IsPlaying {
+		t.Errorf("sleep 0.05: %v, playing %v", err, server.State().IsPlaying)
+	}
+}
+
+func TestPlaySearch(t *testing.T) {
+	s, server := newTestSession(t)
+
+	// A single command plays the best match without asking
+	for query, want := range map[string]string{
+		"finale by mock orchestra": "Finale",
+		"hello by the testers":     "Hello World",
+		"hello again":              "Hello Again",
+		"hello":                    "Hello World",
+	} {
+		if err := runCommand(s, []string{"play-search", query}); err != nil {
+			t.Fatalf("play-search %s: %v", query, err)
+		}
+		if item, _ := server.State().Item(); item.Name != want {
+			t.Errorf("play-search %s played %q, want %q", query, item.Name, want)
+		}
+	}
+	if err := runCommand(s, []string{"play-search", "nothing like this"}); exitCode(err) != exitFailure {
+		t.Errorf("got %v for no match, want a failure", err)
+	}
+
+	// Interactively an ambiguous query lists the candidates to choose from
+	out := runCommands(s, "play-search hello", "2")
+	if !strings.Contains(out, "Play which one? [1-3, Enter for 1]") || !strings.Contains(out, "Playing track: Hello Again") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	runCommands(s, "play-search --first hello")
+	if item, _ := server.State().Item(); item.Name != "Hello World" {
+		t.Errorf("play-search --first played %q, want Hello World", item.Name)
+	}
+}
+
+func TestCommandLoopSearchPages(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "search --limit 2 hello", "more", "more", "play 1")
+	for _, want := range []string{"Results 1-2 of 3", "Results 3-3 of 3", "No more results", "Playing track: Hello Goodbye"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if item, _ := server.State().Item(); item.Name != "Hello Goodbye" {
+		t.Errorf("got item %q, want Hello Goodbye", item.Name)
+	}
+
+	// Going back numbers the first page from 1 again
+	runCommands(s, "back", "play 2")
+	if item, _ := server.State().Item(); item.Name != "Hello Again" {
+		t.Errorf("got item %q after back, want Hello Again", item.Name)
+	}
+
+	for _, words := range [][]string{{"search", "--limit", "0", "x"}, {"search", "--offset", "ten", "x"}} {
+		if err := runCommand(s, words); exitCode(err) != exitUsage {
+			t.Errorf("%q: got %v, want a usage error", words, err)
+		}
+	}
+	s.lastSearchResults = spotify.SearchResults{}
+	if err := runCommand(s, []string{"more"}); exitCode(err) != exitUsage {
+		t.Errorf("more without a search: got %v, want a usage error", err)
+	}
+}
+
+func TestCommandLoopPlayNewAndPlayList(t *testing.T) {
+	s, server := newTestSession(t)
+
+	runCommands(s, "new", "play-new 2")
+	if state := server.State(); state.ContextURI != "spotify:album:album2" {
+		t.Errorf("got context %q after play-new, want album2", state.ContextURI)
+	}
+
+	runCommands(s, "playlists", "play-list 3")
+	if state := server.State(); state.ContextURI != "spotify:playlist:playlist3" {
+		t.Errorf("got context %q after play-list, want playlist3", state.ContextURI)
+	}
+}
+
+func TestCommandLoopPlayerCommands(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "toggle", "next", "next", "prev", "volume 42", "repeat-mode song", "current")
+	if !strings.Contains(out, "Green Tests") || !strings.Contains(out, "Test Laptop") {
+		t.Errorf("current did not render the playing track and device:\n%s", out)
+	}
+
+	state := server.State()
+	if !state.IsPlaying {
+		t.Error("toggle did not start playback")
+	}
+	if state.Index != 1 {
+		t.Errorf("got track index %d, want 1", state.Index)
+	}
+	if device, _ := state.ActiveDevice(); device.VolumePercent != 42 {
+		t.Errorf("got volume %d, want 42", device.VolumePercent)
+	}
+	if state.Repeat != "track" {
+		t.Errorf("got repeat %q, want track", state.Repeat)
+	}
+
+	runCommands(s, "repeat")
+	if repeat := server.State().Repeat; repeat != "context" {
+		t.Errorf("got repeat %q after repeat, want context", repeat)
+	}
+}
+
+func TestCommandLoopRejectsInvalidInput(t *testing.T) {
+	s, server := newTestSession(t)
+
+	out := runCommands(s, "play 1", "play-new x", "play-list 9", "volume loud", "volume 101", "dance")
+	if !strings.Contains(out, "Invalid volume: 101. Use a volume between 0 and 100\n") {
+		t.Errorf("volume 101 was not rejected:\n%s", out)
+	}
+
+	// None of the commands is valid, so no API request reached the server
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Errorf("got API requests %v, want none", requests)
+	}
+}
+
+func TestCommandLoopJSONOutput(t *testing.T) {
+	s, server := newTestSession(t)
+
+	var out, console bytes.Buffer
+	renderer, err := spotify.NewRenderer(spotify.OutputJSON, &out, &console)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.renderer, s.out, s.console = renderer, &console, &console
+	runCommandLoop(s, lineedit.New(strings.NewReader("search hello\nplay 1\n"), &console))
+
+	// Only the search results reach stdout, so the output decodes as a whole
+	var tracks []spotify.TrackRecord
+	if err := json.Unmarshal(out.Bytes(), &tracks); err != nil {
+		t.Fatalf("output is not a JSON track list: %v\n%s", err, out.String())
+	}
+	if len(tracks) != 3 || tracks[0].URI != "spotify:track:album1-track1" {
+		t.Errorf("got tracks %+v, want Hello World first", tracks)
+	}
+	if item, _ := server.State().Item(); item.URI() != tracks[0].URI {
+		t.Errorf("got item %s, want %s", item.URI(), tracks[0].URI)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		output  string
+		command []string
+	}{
+		{nil, "box", nil},
+		{[]string{"next"}, "box", []string{"next"}},
+		{[]string{"current", "--output", "json"}, "json", []string{"current"}},
+		{[]string{"-o=tsv", "search", "daft", "punk"}, "tsv", []string{"search", "daft", "punk"}},
+		{[]string{"search", "--", "--output"}, "box", []string{"search", "--", "--output"}},
+		{[]string{"--", "search", "-o"}, "box", []string{"search", "-o"}},
+		{[]string{"search", "--type", "album", "-o", "tsv", "x"}, "tsv", []string{"search", "--type", "album", "x"}},
+	}
+	for _, tt := range tests {
+		output, command, err := parseArgs(tt.args)
+		if err != nil {
+			t.Errorf("parseArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if output != tt.output || strings.Join(command, " ") != strings.Join(tt.command, " ") {
+			t.Errorf("parseArgs(%q) = %q, %q; want %q, %q", tt.args, output, command, tt.output, tt.command)
+		}
+	}
+
+	if _, _, err := parseArgs([]string{"next", "--output"}); exitCode(err) != exitUsage {
+		t.Errorf("got %v for a missing output format, want a usage error", err)
+	}
+	if _, command, err := parseArgs([]string{"search", "--help"}); !errors.Is(err, flag.ErrHelp) || len(command) != 1 {
+		t.Errorf("got %q, %v for --help, want flag.ErrHelp after search", command, err)
+	}
+}
+
+func TestRunCommandExitCodes(t *testing.T) {
+	s, server := newTestSession(t)
+
+	if err := runCommand(s, []string{"volume", "40"}); exitCode(err) != exitOK {
+		t.Errorf("volume 40: got %v, want success", err)
+	}
+	if err := runCommand(s, []string{"next", "--colour"}); exitCode(err) != exitUsage {
+		t.Errorf("unknown flag: got %v, want a usage error", err)
+	}
+	if err := runCommand(s, []string{"shuffle-everything"}); exitCode(err) != exitUsage {
+		t.Errorf("unknown command: got %v, want a usage error", err)
+	}
+	if err := runCommand(s, []string{"quit"}); exitCode(err) != exitOK {
+		t.Errorf("quit: got %v, want success", err)
+	}
+
+	server.FailNext(1, http.StatusForbidden, "")
+	if err := runCommand(s, []string{"next"}); exitCode(err) != exitFailure {
+		t.Errorf("forbidden next: got %v, want a failure", err)
+	}
+
+	server.SetDevices(nil)
+	if err := runCommand(s, []string{"toggle"}); exitCode(err) != exitNoDevice {
+		t.Errorf("toggle without device: got %v, want no active device", err)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  next  ", []string{"next"}},
+		{`search "daft punk"  around`, []string{"search", "daft punk", "around"}},
+		{`search "unterminated`, nil},
+		{`search it\'s "a \"b\""`, []string{"search", "it's", `a "b"`}},
+		{`search ''`, []string{"search", ""}},
+	}
+	for _, tt := range tests {
+		got, err := tokenize(tt.line)
+		if tt.want == nil && tt.line != "" {
+			if err == nil {
+				t.Errorf("tokenize(%q) = %q, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil || strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("tokenize(%q) = %q, %v; want %q", tt.line, got, err, tt.want)
+		}
+	}
+}
+
+func TestHelpAndSuggestions(t *testing.T) {
+	s, _ := newTestSession(t)
+
+	out := runCommands(s, "help repeat-mode", "serach hello", "vol")
+	for _, want := range []string{
+		"Usage: repeat-mode [mode]",
+		"Values for mode: off, track, context",
+		"Unknown command: serach. Did you mean search?",
+		"Missing percent. Usage: volume <percent>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	for _, name := range []string{"__complet", "complet"} {
+		if got := suggestCommand(name); got != "" {
+			t.Errorf("suggestCommand(%q) = %q, want no suggestion of the hidden command", name, got)
+		}
+	}
+
+	// Every command but the hidden ones is listed by help, and names and aliases are unique
+	out = runCommands(s, "help")
+	seen := map[string]bool{}
+	for _, cmd := range registry {
+		if listed := strings.Contains(out, cmd.usage()); listed == cmd.hidden {
+			t.Errorf("help lists %s: %v, want %v", cmd.name, listed, !cmd.hidden)
+		}
+		for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+			if seen[name] {
+				t.Errorf("%s is registered twice", name)
+			}
+			seen[name] = true
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s, server := newTestSession(t)
+	runCommands(s, "search hello")
+
+	tests := []struct {
+		head  string
+		want  []string
+		start int
+	}{
+		{"", nil, 0}, // every command, checked below
+		{"rep", []string{"repeat", "repeat-mode"}, 0},
+		{"repeat-mode s", []string{"song"}, 12},
+		{"play ", []string{"1", "2", "3"}, 5},
+		{"play-new ", []string{"--shuffle"}, 9},
+		{"play-list mor", []string{`"Morning Mix"`}, 10},
+		{`play-list "Sleep S`, []string{`"Sleep Sounds"`}, 10},
+		{"next ", nil, 5},
+		{"dance ", nil, 6},
+	}
+	for _, tt := range tests {
+		got, start := s.complete(tt.head)
+		if tt.head == "" {
+			if len(got) < len(registry) {
+				t.Errorf("complete(%q) = %q, want every command", tt.head, got)
+			}
+			continue
+		}
+		if start != tt.start || strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("complete(%q) = %q, %d; want %q, %d", tt.head, got, start, tt.want, tt.start)
+		}
+	}
+
+	runCommands(s, "play-list sleep sounds")
+	if state := server.State(); state.ContextURI != "spotify:playlist:playlist3" {
+		t.Errorf("got context %q after play-list by name, want playlist3", state.ContextURI)
+	}
+}
+
+func TestShellCompletion(t *testing.T) {
+	s, _ := newTestSession(t)
+	out := s.out.(*bytes.Buffer)
+
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"repeat-mode", "a"}, "album\n"},
+		{[]string{"play-list", "mo"}, "Morning Mix\n"},
+		{[]string{"play-list", `"Sleep`}, "Sleep Sounds\n"},
+		{[]string{"--output", "json", "prev"}, "prev\nprevious\n"},
+		{[]string{"-o", "nd"}, "ndjson\n"},
+		{[]string{"completion", ""}, "bash\nzsh\nfish\n"},
+		{[]string{"__comp"}, ""},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		if err := runCommand(s, append([]string{"__complete", "--"}, tt.words...)); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("__complete %q printed %q, want %q", tt.words, out.String(), tt.want)
+		}
+	}
+
+	for _, shell := range completionShells {
+		out.Reset()
+		if err := runCommand(s, []string{"completion", shell}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "spotify-cli __complete -- ") {
+			t.Errorf("%s script does not call __complete:\n%s", shell, out.String())
+		}
+	}
+	if err := runCommand(s, []string{"completion", "tcsh"}); exitCode(err) != exitUsage {
+		t.Errorf("completion tcsh: got %v, want a usage error", err)
+	}
+}
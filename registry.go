@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// argKind is the type of value a command argument accepts
+type argKind int
+
+const (
+	argWord   argKind = iota // a single word
+	argNumber                // an integer
+	argRest                  // the rest of the line, joined with spaces
+	argWords                 // the remaining words, kept apart
+)
+
+// argSpec declares one argument of a command
+type argSpec struct {
+	name     string
+	kind     argKind
+	optional bool
+	values   []string // accepted values, for help and completion
+	complete func(s *session) []string
+}
+
+// flagSpec declares a --flag of a command
+type flagSpec struct {
+	name     string
+	value    string // name of the value in help; empty for a boolean flag
+	help     string
+	values   []string // accepted values, for help and completion
+	complete func(s *session) []string
+}
+
+// flagValues holds the flags given to a command; boolean flags are set to "true"
+type flagValues map[string]string
+
+// number returns the value of a numeric flag, checked against its range, or 0 if
+// the flag is not set
+func (f flagValues) number(name string, low, high int) (int, error) {
+	value, ok := f[name]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, usageError(fmt.Sprintf("Invalid --%s: %s is not a number", name, value))
+	}
+	if n < low || n > high {
+		return 0, usageError(fmt.Sprintf("Invalid --%s: %d is not between %d and %d", name, n, low, high))
+	}
+	return n, nil
+}
+
+// command is an entry of the command registry
+type command struct {
+	name    string
+	aliases []string
+	args    []argSpec
+	flags   []flagSpec
+	help    string
+	run     func(s *session, args []string, flags flagValues) error
+	offline bool // runs without signing in to Spotify
+	hidden  bool // left out of help and completion
+}
+
+// usage returns the command with its arguments, e.g. "repeat-mode [mode]"
+func (c *command) usage() string {
+	parts := []string{c.name}
+	if len(c.flags) > 0 {
+		parts = append(parts, "[flags]")
+	}
+	for _, arg := range c.args {
+		name := arg.name
+		if arg.kind == argRest || arg.kind == argWords {
+			name += "..."
+		}
+		if arg.optional {
+			parts = append(parts, "["+name+"]")
+		} else {
+			parts = append(parts, "<"+name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// flag returns the flag spec with the given name
+func (c *command) flag(name string) (flagSpec, bool) {
+	for _, spec := range c.flags {
+		if spec.name == name {
+			return spec, true
+		}
+	}
+	return flagSpec{}, false
+}
+
+// bind checks the words following the command name against its flags and
+// argument schema. Flags are written --name value or --name=value and may
+// appear anywhere; words after "--" are never flags.
+func (c *command) bind(words []string) ([]string, flagValues, error) {
+	flags := flagValues{}
+	var positional []string
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if word == "--" {
+			positional = append(positional, words[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(word, "--") || len(word) == 2 {
+			positional = append(positional, word)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(word[2:], "=")
+		spec, ok := c.flag(name)
+		if !ok {
+			return nil, nil, usageError(fmt.Sprintf("Unknown flag --%s. Usage: %s", name, c.usage()))
+		}
+		if spec.value == "" {
+			if hasValue {
+				return nil, nil, usageError(fmt.Sprintf("Flag --%s does not take a value", name))
+			}
+			value = "true"
+		} else if !hasValue {
+			if i+1 >= len(words) {
+				return nil, nil, usageError(fmt.Sprintf("Flag --%s needs a %s", name, spec.value))
+			}
+			i++
+			value = words[i]
+		}
+		flags[name] = value
+	}
+
+	args, err := c.bindArgs(positional)
+	return args, flags, err
+}
+
+// bindArgs checks the positional words against the argument schema
+func (c *command) bindArgs(words []string) ([]string, error) {
+	var args []string
+	for i, spec := range c.args {
+		if i >= len(words) {
+			if spec.optional {
+				break
+			}
+			return nil, usageError(fmt.Sprintf("Missing %s. Usage: %s", spec.name, c.usage()))
+		}
+		if spec.kind == argRest {
+			return append(args, strings.Join(words[i:], " ")), nil
+		}
+		if spec.kind == argWords {
+			return append(args, words[i:]...), nil
+		}
+		if spec.kind == argNumber {
+			if _, err := strconv.Atoi(words[i]); err != nil {
+				return nil, usageError(fmt.Sprintf("Invalid %s: %s is not a number", spec.name, words[i]))
+			}
+		}
+		args = append(args, words[i])
+	}
+	if len(words) > len(c.args) {
+		return nil, usageError("Too many arguments. Usage: " + c.usage())
+	}
+	return args, nil
+}
+
+// lookupCommand finds a command by name or alias
+func lookupCommand(name string) *command {
+	for _, cmd := range registry {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// suggestCommand returns the command name closest to a mistyped one, or "" if none is close.
+// Hidden commands are never suggested.
+func suggestCommand(name string) string {
+	best, bestDistance := "", 3
+	for _, cmd := range registry {
+		if cmd.hidden {
+			continue
+		}
+		for _, candidate := range append([]string{cmd.name}, cmd.aliases...) {
+			if d := editDistance(name, candidate); d < bestDistance {
+				best, bestDistance = cmd.name, d
+			}
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// tokenize splits a command line into words. Single and double quotes group
+// words, and a backslash escapes the next character outside single quotes.
+func tokenize(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'' && r == '\'':
+			quote = 0
+		case quote == '"' && r == '"':
+			quote = 0
+		case r == '\\' && quote != '\'':
+			if i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+				inWord = true
+			}
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, usageError("Unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// printHelp lists every command, or describes the named one
+func printHelp(w io.Writer, name string) error {
+	if name == "" {
+		fmt.Fprintln(w, "\nCommands:")
+		for _, cmd := range registry {
+			if !cmd.hidden {
+				fmt.Fprintf(w, "  %-26s %s\n", cmd.usage(), cmd.help)
+			}
+		}
+		fmt.Fprintln(w, "\nType 'help <command>' for details.")
+		return nil
+	}
+
+	cmd := lookupCommand(name)
+	if cmd == nil {
+		return unknownCommand(name)
+	}
+	fmt.Fprintf(w, "Usage: %s\n%s\n", cmd.usage(), cmd.help)
+	if len(cmd.aliases) > 0 {
+		fmt.Fprintf(w, "Aliases: %s\n", strings.Join(cmd.aliases, ", "))
+	}
+	for _, arg := range cmd.args {
+		if len(arg.values) > 0 {
+			fmt.Fprintf(w, "Values for %s: %s\n", arg.name, strings.Join(arg.values, ", "))
+		}
+	}
+	if len(cmd.flags) > 0 {
+		fmt.Fprintln(w, "Flags:")
+		for _, spec := range cmd.flags {
+			flag := "--" + spec.name
+			if spec.value != "" {
+				flag += " <" + spec.value + ">"
+			}
+			fmt.Fprintf(w, "  %-24s %s\n", flag, spec.help)
+		}
+	}
+	return nil
+}
+
+// unknownCommand returns the usage error for a command that is not registered
+func unknownCommand(name string) error {
+	if suggestion := suggestCommand(name); suggestion != "" {
+		return usageError(fmt.Sprintf("Unknown command: %s. Did you mean %s?", name, suggestion))
+	}
+	return usageError(fmt.Sprintf("Unknown command: %s. Type 'help' for a list of commands", name))
+}
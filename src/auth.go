@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	mathrand "math/rand"
@@ -15,6 +16,12 @@ import (
 	"time"
 )
 
+var errStateMismatch = errors.New("state mismatch, possible CSRF attack. This could happen if:\n" +
+	"1. The authorization process was interrupted or timed out\n" +
+	"2. You're using an old or invalid redirect URL\n" +
+	"3. You started multiple authorization processes\n" +
+	"Please try again from the beginning.")
+
 // Generate a random string for state parameter
 func generateRandomString(length int) string {
 	b := make([]byte, length)
@@ -36,15 +43,54 @@ func fallbackRandomString(length int) string {
 	return string(b)
 }
 
+// StartAuthFlow authenticates the client, reusing the saved token when possible
 func (c *SpotifyClient) StartAuthFlow() error {
-	// Check if we have a refresh token saved
-	refreshToken, err := os.ReadFile(".refresh_token")
-	if err == nil && len(refreshToken) > 0 {
-		// Try to use the refresh token
-		if err := c.refreshAccessToken(string(refreshToken)); err == nil {
-			return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.startAuthFlow()
+}
+
+// ResumeSession loads the saved token, refreshing it if it has expired, without
+// ever starting an interactive login. It is meant for callers that cannot prompt,
+// such as shell completion.
+func (c *SpotifyClient) ResumeSession() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.TokenStore == nil {
+		return ErrNoToken
+	}
+	token, err := c.TokenStore.Load()
+	if err != nil {
+		return err
+	}
+	c.token = token
+	if token.Expired(tokenExpiryLeeway) {
+		return c.refreshLocked()
+	}
+	return nil
+}
+
+func (c *SpotifyClient) startAuthFlow() error {
+	// Check if we have a token saved
+	if c.TokenStore != nil {
+		token, err := c.TokenStore.Load()
+		if err == nil {
+			c.token = token
+			if !token.Expired(tokenExpiryLeeway) {
+				return nil
+			}
+			// Try to use the refresh token
+			if token.RefreshToken != "" {
+				if err := c.refreshAccessToken(token.RefreshToken); err == nil {
+					return nil
+				}
+			}
+			// If refresh fails, continue with new auth flow
+		} else if !errors.Is(err, ErrNoToken) {
+			fmt.Fprintf(c.console(), "Warning: Could not load saved token: %v\n", err)
 		}
-		// If refresh fails, continue with new auth flow
 	}
 
 	// Start authorization code flow
@@ -66,7 +112,7 @@ func (c *SpotifyClient) StartAuthFlow() error {
 
 	// Generate a random state value
 	state := generateRandomString(16)
-	fmt.Printf("Generated state: %s\n", state)
+	fmt.Fprintf(c.console(), "Generated state: %s\n", state)
 
 	// Save the state to a temporary file for later verification
 	if err := os.WriteFile(".auth_state", []byte(state), 0600); err != nil {
@@ -74,7 +120,7 @@ func (c *SpotifyClient) StartAuthFlow() error {
 	}
 
 	// Build the authorization URL
-	authURL := "https://accounts.spotify.com/authorize"
+	authURL := c.accountsURL("/authorize")
 	params := url.Values{}
 	params.Add("client_id", c.ClientID)
 	params.Add("response_type", "code")
@@ -82,14 +128,33 @@ func (c *SpotifyClient) StartAuthFlow() error {
 	params.Add("scope", strings.Join(scopes, " "))
 	params.Add("state", state)
 
+	if c.UsePKCE {
+		if err := startPKCE(params); err != nil {
+			return err
+		}
+	}
+
 	authFullURL := authURL + "?" + params.Encode()
 
 	// Open the URL in the browser
-	fmt.Printf("Please open the following URL in your browser:\n%s\n", authFullURL)
-	fmt.Println("After authorizing, you will be redirected to a URL.")
-	fmt.Println("Option 1: Paste the full redirect URL here")
-	fmt.Println("Option 2: Type 'manual' to enter the authorization code and state manually")
-	fmt.Print("Enter your choice: ")
+	fmt.Fprintf(c.console(), "Please open the following URL in your browser:\n%s\n", authFullURL)
+
+	// Catch the redirect with a local callback server when the redirect URI allows it
+	code, err := waitForCallback(redirectURI, state, callbackTimeout(c.console()), c.console())
+	if err == nil {
+		os.Remove(".auth_state")
+		return c.exchangeCodeForToken(code, redirectURI)
+	}
+	if !errors.Is(err, errNoCallback) {
+		os.Remove(".auth_state")
+		return err
+	}
+	fmt.Fprintf(c.console(), "Could not receive the authorization callback automatically: %v\n", err)
+
+	fmt.Fprintln(c.console(), "After authorizing, you will be redirected to a URL.")
+	fmt.Fprintln(c.console(), "Option 1: Paste the full redirect URL here")
+	fmt.Fprintln(c.console(), "Option 2: Type 'manual' to enter the authorization code and state manually")
+	fmt.Fprint(c.console(), "Enter your choice: ")
 
 	// Read the redirected URL from user input
 	reader := bufio.NewReader(os.Stdin)
@@ -102,14 +167,14 @@ func (c *SpotifyClient) StartAuthFlow() error {
 	// Check if the user entered a URL or wants to use manual entry
 	if strings.HasPrefix(redirectedURL, "manual") {
 		// Manual entry mode
-		fmt.Println("Enter the authorization code:")
+		fmt.Fprintln(c.console(), "Enter the authorization code:")
 		code, err := reader.ReadString('\n')
 		if err != nil {
 			return fmt.Errorf("error reading code: %v", err)
 		}
 		code = strings.TrimSpace(code)
 		
-		fmt.Println("Enter the state parameter:")
+		fmt.Fprintln(c.console(), "Enter the state parameter:")
 		receivedState, err := reader.ReadString('\n')
 		if err != nil {
 			return fmt.Errorf("error reading state: %v", err)
@@ -122,15 +187,11 @@ func (c *SpotifyClient) StartAuthFlow() error {
 			return fmt.Errorf("error reading saved auth state: %v", err)
 		}
 		
-		fmt.Printf("Saved state: %s\n", string(savedState))
-		fmt.Printf("Received state: %s\n", receivedState)
+		fmt.Fprintf(c.console(), "Saved state: %s\n", string(savedState))
+		fmt.Fprintf(c.console(), "Received state: %s\n", receivedState)
 		
 		if receivedState != string(savedState) {
-			return fmt.Errorf("state mismatch, possible CSRF attack. This could happen if:\n" +
-				"1. The authorization process was interrupted or timed out\n" +
-				"2. You're using an old or invalid redirect URL\n" +
-				"3. You started multiple authorization processes\n" +
-				"Please try again from the beginning.")
+			return errStateMismatch
 		}
 		
 		// Clean up the state file after verification
@@ -144,7 +205,7 @@ func (c *SpotifyClient) StartAuthFlow() error {
 		return c.exchangeCodeForToken(code, redirectURI)
 	}
 	
-	fmt.Printf("Received URL: %s\n", redirectedURL)
+	fmt.Fprintf(c.console(), "Received URL: %s\n", redirectedURL)
 
 	// Parse the URL to extract the authorization code
 	parsedURL, err := url.Parse(redirectedURL)
@@ -164,21 +225,17 @@ func (c *SpotifyClient) StartAuthFlow() error {
 	}
 	
 	receivedState := queryParams.Get("state")
-	fmt.Printf("Saved state: %s\n", string(savedState))
-	fmt.Printf("Received state: %s\n", receivedState)
+	fmt.Fprintf(c.console(), "Saved state: %s\n", string(savedState))
+	fmt.Fprintf(c.console(), "Received state: %s\n", receivedState)
 
 	if receivedState != string(savedState) {
-		return fmt.Errorf("state mismatch, possible CSRF attack. This could happen if:\n" +
-			"1. The authorization process was interrupted or timed out\n" +
-			"2. You're using an old or invalid redirect URL\n" +
-			"3. You started multiple authorization processes\n" +
-			"Please try again from the beginning.")
+		return errStateMismatch
 	}
 
 	// Clean up the state file after verification
 	os.Remove(".auth_state")
 
-	code := queryParams.Get("code")
+	code = queryParams.Get("code")
 	if code == "" {
 		return fmt.Errorf("no authorization code found in the redirected URL")
 	}
@@ -189,25 +246,41 @@ func (c *SpotifyClient) StartAuthFlow() error {
 
 // Exchange authorization code for access token
 func (c *SpotifyClient) exchangeCodeForToken(code string, redirectURI string) error {
-	tokenURL := "https://accounts.spotify.com/api/token"
-	auth := base64.StdEncoding.EncodeToString([]byte(c.ClientID + ":" + c.ClientSecret))
-
 	formData := url.Values{}
 	formData.Add("grant_type", "authorization_code")
 	formData.Add("code", code)
 	formData.Add("redirect_uri", redirectURI)
 
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(formData.Encode()))
-	if err != nil {
-		return fmt.Errorf("error creating token request: %v", err)
+	if c.UsePKCE {
+		verifier, err := loadVerifier()
+		if err != nil {
+			return err
+		}
+		formData.Add("code_verifier", verifier)
+		defer os.Remove(verifierFile)
 	}
 
-	req.Header.Add("Authorization", "Basic "+auth)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return c.requestToken(formData, "token")
+}
+
+func (c *SpotifyClient) refreshAccessToken(refreshToken string) error {
+	formData := url.Values{}
+	formData.Add("grant_type", "refresh_token")
+	formData.Add("refresh_token", refreshToken)
+
+	return c.requestToken(formData, "refresh token")
+}
+
+// requestToken calls the token endpoint and stores the resulting token
+func (c *SpotifyClient) requestToken(formData url.Values, kind string) error {
+	req, err := c.newTokenRequest(formData)
+	if err != nil {
+		return fmt.Errorf("error creating %s request: %v", kind, err)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
-		return fmt.Errorf("error making token request: %v", err)
+		return fmt.Errorf("error making %s request: %v", kind, err)
 	}
 	defer resp.Body.Close()
 
@@ -216,95 +289,101 @@ func (c *SpotifyClient) exchangeCodeForToken(code string, redirectURI string) er
 		TokenType    string `json:"token_type"`
 		ExpiresIn    int    `json:"expires_in"`
 		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("error reading token response: %v", err)
+		return fmt.Errorf("error reading %s response: %v", kind, err)
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return fmt.Errorf("error parsing token response: %v", err)
+		return fmt.Errorf("error parsing %s response: %v", kind, err)
 	}
 
 	if result.AccessToken == "" {
 		return fmt.Errorf("no access token received: %s", string(body))
 	}
 
-	c.AccessToken = result.AccessToken
+	token := &Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+		Scopes:       strings.Fields(result.Scope),
+	}
+
+	// Spotify may omit the refresh token on refresh, in which case the old one stays valid
+	if token.RefreshToken == "" && c.token != nil {
+		token.RefreshToken = c.token.RefreshToken
+	}
+
+	c.token = token
 
-	// Save the refresh token for future use
-	if result.RefreshToken != "" {
-		if err := os.WriteFile(".refresh_token", []byte(result.RefreshToken), 0600); err != nil {
-			fmt.Printf("Warning: Could not save refresh token: %v\n", err)
+	// Save the token for future sessions
+	if c.TokenStore != nil {
+		if err := c.TokenStore.Save(token); err != nil {
+			fmt.Fprintf(c.console(), "Warning: Could not save token: %v\n", err)
 		}
 	}
 
 	return nil
 }
 
-func (c *SpotifyClient) refreshAccessToken(refreshToken string) error {
-	tokenURL := "https://accounts.spotify.com/api/token"
-	auth := base64.StdEncoding.EncodeToString([]byte(c.ClientID + ":" + c.ClientSecret))
-
-	formData := url.Values{}
-	formData.Add("grant_type", "refresh_token")
-	formData.Add("refresh_token", refreshToken)
+// authorize adds the bearer token to a request, refreshing it first if it is about to expire
+func (c *SpotifyClient) authorize(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(formData.Encode()))
-	if err != nil {
-		return fmt.Errorf("error creating refresh token request: %v", err)
+	if c.token == nil || c.token.AccessToken == "" {
+		return fmt.Errorf("not authenticated")
 	}
 
-	req.Header.Add("Authorization", "Basic "+auth)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error making refresh token request: %v", err)
+	if c.token.Expired(tokenExpiryLeeway) && c.token.RefreshToken != "" {
+		if err := c.refreshAccessToken(c.token.RefreshToken); err != nil {
+			return fmt.Errorf("error refreshing access token: %v", err)
+		}
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		AccessToken  string `json:"access_token"`
-		TokenType    string `json:"token_type"`
-		ExpiresIn    int    `json:"expires_in"`
-		RefreshToken string `json:"refresh_token"`
-	}
+	req.Header.Set("Authorization", "Bearer "+c.token.AccessToken)
+	return nil
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("error parsing refresh token response: %v", err)
-	}
+// Token returns a copy of the current token, or nil before authentication
+func (c *SpotifyClient) Token() *Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if result.AccessToken == "" {
-		return fmt.Errorf("no access token received from refresh")
+	if c.token == nil {
+		return nil
 	}
+	token := *c.token
+	return &token
+}
 
-	c.AccessToken = result.AccessToken
-
-	// Save the new refresh token if provided
-	if result.RefreshToken != "" {
-		if err := os.WriteFile(".refresh_token", []byte(result.RefreshToken), 0600); err != nil {
-			fmt.Printf("Warning: Could not save refresh token: %v\n", err)
-		}
-	}
+// RefreshToken exchanges the refresh token for a new access token.
+// It never starts an interactive authorization flow.
+func (c *SpotifyClient) RefreshToken() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return nil
+	return c.refreshLocked()
 }
 
-func (c *SpotifyClient) RefreshToken() error {
-	// Try to read the saved refresh token
-	refreshToken, err := os.ReadFile(".refresh_token")
-	if err != nil || len(refreshToken) == 0 {
-		// If no refresh token, start a new auth flow
-		return c.StartAuthFlow()
-	}
+// forceRefresh refreshes the access token after the API rejected it, unless another
+// request already replaced the rejected token
+func (c *SpotifyClient) forceRefresh(rejectedAuthorization string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// Try to refresh the token
-	if err := c.refreshAccessToken(string(refreshToken)); err != nil {
-		// If refresh fails, start a new auth flow
-		return c.StartAuthFlow()
+	if c.token != nil && "Bearer "+c.token.AccessToken != rejectedAuthorization {
+		return nil
 	}
+	return c.refreshLocked()
+}
 
-	return nil
+func (c *SpotifyClient) refreshLocked() error {
+	if c.token == nil || c.token.RefreshToken == "" {
+		return fmt.Errorf("no refresh token available, please restart to log in again")
+	}
+	return c.refreshAccessToken(c.token.RefreshToken)
 }
@@ -1,11 +1,8 @@
 package spotify
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
@@ -29,34 +26,30 @@ func GetPreferredBrowser() Browser {
 	return Firefox
 }
 
-// Convert Spotify URI to web URL
-func convertURItoURL(uri string) string {
-	parts := strings.Split(uri, ":")
-	if len(parts) < 3 {
-		return "https://open.spotify.com"
-	}
-
-	resourceType := parts[1]
-	resourceID := parts[2]
-	return fmt.Sprintf("https://open.spotify.com/%s/%s", resourceType, resourceID)
-}
-
-func (c *SpotifyClient) PlayTrack(uri string) error {
+// PlayTrack plays a track or episode, opening it in the browser when there is
+// no device to play on
+func (c *SpotifyClient) PlayTrack(uri string) (Playback, error) {
 	// First, try to play the track via the Spotify API
-	err := c.playTrackViaAPI(uri)
-	if err == nil {
-		return nil
+	device, err := c.startPlayback(uri, false)
+	if errors.Is(err, ErrNoActiveDevice) {
+		// Without a device to play on, fall back to browser playback
+		return openInBrowser(uri, err)
 	}
+	return Playback{Device: device}, err
+}
 
-	// If API playback fails, fall back to browser playback
-	fmt.Printf("API playback failed: %v\nFalling back to browser playback...\n", err)
-
+// openInBrowser opens the web player page of uri in the preferred browser, as
+// playing it on a device failed with reason. When the browser cannot be opened
+// either, the error wraps reason.
+func openInBrowser(uri string, reason error) (Playback, error) {
 	// Convert Spotify URI to web URL
-	webURL := convertURItoURL(uri)
+	webURL := "https://open.spotify.com"
+	if parsed, err := ParseURI(uri); err == nil {
+		webURL = parsed.URL()
+	}
 
 	// Get preferred browser
 	browser := GetPreferredBrowser()
-	fmt.Printf("Opening %s in %s...\n", webURL, browser)
 
 	// Try to play in the browser
 	var cmd *exec.Cmd
@@ -138,132 +131,8 @@ func (c *SpotifyClient) PlayTrack(uri string) error {
 	}
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error controlling %s: %v", browser, err)
-	}
-
-	return nil
-}
-
-func (c *SpotifyClient) playTrackViaAPI(uri string) error {
-	// First, check for available devices
-	req, err := http.NewRequest("GET", "https://api.spotify.com/v1/me/player/devices", nil)
-	if err != nil {
-		return fmt.Errorf("error creating devices request: %v", err)
-	}
-
-	req.Header.Add("Authorization", "Bearer "+c.AccessToken)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error making devices request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	var deviceResult struct {
-		Devices []struct {
-			ID     string `json:"id"`
-			Name   string `json:"name"`
-			Type   string `json:"type"`
-			Active bool   `json:"is_active"`
-		} `json:"devices"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&deviceResult); err != nil {
-		return fmt.Errorf("error parsing devices response: %v", err)
-	}
-
-	// Check if we have any devices
-	if len(deviceResult.Devices) == 0 {
-		return fmt.Errorf("no available Spotify devices found")
-	}
-
-	// First try to find an active device
-	var deviceID string
-	for _, device := range deviceResult.Devices {
-		if device.Active {
-			deviceID = device.ID
-			fmt.Printf("Using active device: %s\n", device.Name)
-			break
-		}
-	}
-
-	// If no active device, look for any device with preference for web player
-	if deviceID == "" {
-		for _, device := range deviceResult.Devices {
-			if strings.Contains(strings.ToLower(device.Name), "web player") {
-				deviceID = device.ID
-				fmt.Printf("Using Web Player device: %s\n", device.Name)
-				break
-			}
-		}
-	}
-
-	// If still no device, use the first available one
-	if deviceID == "" && len(deviceResult.Devices) > 0 {
-		deviceID = deviceResult.Devices[0].ID
-		fmt.Printf("Using device: %s\n", deviceResult.Devices[0].Name)
-	}
-
-	// If we found a device, play the track on it
-	if deviceID != "" {
-		// Determine if this is a track or album URI
-		uriParts := strings.Split(uri, ":")
-		isAlbum := false
-		if len(uriParts) >= 2 && uriParts[1] == "album" {
-			isAlbum = true
-			fmt.Println("Detected album URI, will play entire album")
-		}
-
-		// Create appropriate request body based on URI type
-		var playBody map[string]interface{}
-		if isAlbum {
-			// For albums, use context_uri
-			playBody = map[string]interface{}{
-				"context_uri": uri,
-			}
-		} else {
-			// For tracks, use uris array
-			playBody = map[string]interface{}{
-				"uris": []string{uri},
-			}
-		}
-
-		playJSON, err := json.Marshal(playBody)
-		if err != nil {
-			return fmt.Errorf("error marshaling play request: %v", err)
-		}
-
-		playURL := "https://api.spotify.com/v1/me/player/play"
-		if deviceID != "" {
-			playURL += "?device_id=" + deviceID
-		}
-
-		playReq, err := http.NewRequest("PUT", playURL, bytes.NewBuffer(playJSON))
-		if err != nil {
-			return fmt.Errorf("error creating play request: %v", err)
-		}
-
-		playReq.Header.Add("Authorization", "Bearer "+c.AccessToken)
-		playReq.Header.Add("Content-Type", "application/json")
-
-		playResp, err := http.DefaultClient.Do(playReq)
-		if err != nil {
-			return fmt.Errorf("error making play request: %v", err)
-		}
-		defer playResp.Body.Close()
-
-		if playResp.StatusCode != http.StatusNoContent && playResp.StatusCode != http.StatusOK {
-			// Read the error response for better debugging
-			errorBody, _ := io.ReadAll(playResp.Body)
-			return fmt.Errorf("play request failed with status %s: %s", playResp.Status, string(errorBody))
-		}
-
-		if isAlbum {
-			fmt.Println("Playing album in Spotify player")
-		} else {
-			fmt.Println("Playing track in Spotify player")
-		}
-		return nil
+		return Playback{}, fmt.Errorf("%w, and error controlling %s: %v", reason, browser, err)
 	}
 
-	return fmt.Errorf("no suitable device found for playback")
+	return Playback{Browser: browser, URL: webURL, Fallback: reason}, nil
 }
@@ -0,0 +1,144 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Default time to wait for the browser to hit the local callback server
+const defaultCallbackTimeout = 2 * time.Minute
+
+// errNoCallback is returned when the callback server could not be used and
+// the caller should fall back to the manual paste flow
+var errNoCallback = errors.New("callback not received")
+
+// callbackResult carries what the callback handler received from Spotify
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// callbackTimeout returns the callback wait time from SPOTIFY_AUTH_TIMEOUT or the default,
+// warning on console about an invalid value
+func callbackTimeout(console io.Writer) time.Duration {
+	if value := os.Getenv("SPOTIFY_AUTH_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			return timeout
+		}
+		fmt.Fprintf(console, "Warning: ignoring invalid SPOTIFY_AUTH_TIMEOUT %q\n", value)
+	}
+	return defaultCallbackTimeout
+}
+
+// loopbackAddress returns the listen address for a redirect URI pointing at this machine
+func loopbackAddress(redirectURI string) (string, string, error) {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing redirect URI: %v", err)
+	}
+
+	if parsed.Scheme != "http" {
+		return "", "", fmt.Errorf("redirect URI scheme must be http, got %q", parsed.Scheme)
+	}
+
+	host := parsed.Hostname()
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return "", "", fmt.Errorf("redirect URI host %q is not a loopback address", host)
+		}
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "80"
+	}
+
+	path := parsed.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return net.JoinHostPort(host, port), path, nil
+}
+
+// waitForCallback serves the redirect URI locally until Spotify redirects the
+// browser back with an authorization code or the timeout expires, telling on
+// console what it waits for
+func waitForCallback(redirectURI, state string, timeout time.Duration, console io.Writer) (string, error) {
+	addr, path, err := loopbackAddress(redirectURI)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errNoCallback, err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("%w: error starting callback server: %v", errNoCallback, err)
+	}
+
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		var result callbackResult
+		switch {
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("authorization error: %s", query.Get("error"))
+		case query.Get("state") != state:
+			result.err = errStateMismatch
+		case query.Get("code") == "":
+			result.err = fmt.Errorf("no authorization code found in the callback")
+		default:
+			result.code = query.Get("code")
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if result.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, callbackPage, "Authorization failed", html.EscapeString(result.err.Error()))
+		} else {
+			fmt.Fprintf(w, callbackPage, "Authorization complete", "You can close this tab and return to the terminal.")
+		}
+
+		select {
+		case results <- result:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	fmt.Fprintf(console, "Waiting for authorization on %s (timeout %s)...\n", redirectURI, timeout)
+
+	select {
+	case result := <-results:
+		return result.code, result.err
+	case <-time.After(timeout):
+		return "", fmt.Errorf("%w: timed out after %s", errNoCallback, timeout)
+	}
+}
+
+const callbackPage = `<!DOCTYPE html>
+<html>
+<head><title>Spotify CLI</title></head>
+<body style="font-family: sans-serif; text-align: center; margin-top: 4em;">
+<h1>%s</h1>
+<p>%s</p>
+</body>
+</html>
+`
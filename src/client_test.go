@@ -0,0 +1,723 @@
+package spotify_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	spotify "spotify-cli/src"
+	"spotify-cli/src/spotifytest"
+)
+
+// newTestClient starts a fake server and returns a client authenticated against it
+func newTestClient(t *testing.T) (*spotify.SpotifyClient, *spotifytest.Server) {
+	t.Helper()
+
+	server := spotifytest.NewServer()
+	t.Cleanup(server.Close)
+
+	client := &spotify.SpotifyClient{
+		ClientID:        spotifytest.ClientID,
+		ClientSecret:    spotifytest.ClientSecret,
+		TokenStore:      spotify.NewMemoryTokenStore(&spotify.Token{RefreshToken: spotifytest.RefreshToken}),
+		Retry:           spotify.RetryPolicy{BaseDelay: time.Millisecond},
+		APIBaseURL:      server.APIBaseURL(),
+		AccountsBaseURL: server.AccountsBaseURL(),
+		HTTPClient:      server.Client(),
+	}
+	if err := client.StartAuthFlow(); err != nil {
+		t.Fatalf("StartAuthFlow: %v", err)
+	}
+	return client, server
+}
+
+func TestStartAuthFlowRefreshesSavedToken(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	token := client.Token()
+	if token == nil || token.AccessToken == "" {
+		t.Fatal("no access token after StartAuthFlow")
+	}
+	if token.RefreshToken != spotifytest.RefreshToken {
+		t.Errorf("got refresh token %q, want %q", token.RefreshToken, spotifytest.RefreshToken)
+	}
+	if time.Until(token.Expiry) < 59*time.Minute {
+		t.Errorf("got expiry %s, want about an hour from now", token.Expiry)
+	}
+	if len(token.Scopes) == 0 {
+		t.Error("granted scopes were not recorded")
+	}
+}
+
+// unsavableTokenStore loads the saved token but fails to save a new one
+type unsavableTokenStore struct{ spotify.TokenStore }
+
+func (unsavableTokenStore) Save(*spotify.Token) error { return errors.New("disk full") }
+
+func TestAuthWarningsGoToConsole(t *testing.T) {
+	server := spotifytest.NewServer()
+	defer server.Close()
+
+	// Warnings must not mix with results written to stdout
+	var console bytes.Buffer
+	client := &spotify.SpotifyClient{
+		ClientID:        spotifytest.ClientID,
+		ClientSecret:    spotifytest.ClientSecret,
+		TokenStore:      unsavableTokenStore{spotify.NewMemoryTokenStore(&spotify.Token{RefreshToken: spotifytest.RefreshToken})},
+		APIBaseURL:      server.APIBaseURL(),
+		AccountsBaseURL: server.AccountsBaseURL(),
+		Console:         &console,
+	}
+	if err := client.StartAuthFlow(); err != nil {
+		t.Fatalf("StartAuthFlow: %v", err)
+	}
+	if got := console.String(); got != "Warning: Could not save token: disk full\n" {
+		t.Errorf("got console output %q, want the save warning", got)
+	}
+}
+
+func TestPKCERefreshSendsNoSecret(t *testing.T) {
+	server := spotifytest.NewServer()
+	defer server.Close()
+
+	// The fake rejects Basic auth with a wrong secret, so success means none was sent
+	client := &spotify.SpotifyClient{
+		ClientID:        spotifytest.ClientID,
+		ClientSecret:    "wrong-secret",
+		UsePKCE:         true,
+		TokenStore:      spotify.NewMemoryTokenStore(&spotify.Token{RefreshToken: spotifytest.RefreshToken}),
+		APIBaseURL:      server.APIBaseURL(),
+		AccountsBaseURL: server.AccountsBaseURL(),
+	}
+	if err := client.StartAuthFlow(); err != nil {
+		t.Fatalf("StartAuthFlow: %v", err)
+	}
+}
+
+func TestSearchTracks(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	results, err := client.SearchTracks("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Hello World", "Hello Again", "Hello Goodbye"}
+	if len(results.Tracks) != len(want) {
+		t.Fatalf("got %d tracks, want %d", len(results.Tracks), len(want))
+	}
+	for i, track := range results.Tracks {
+		if track.Name != want[i] {
+			t.Errorf("track %d = %q, want %q", i, track.Name, want[i])
+		}
+	}
+}
+
+func TestSearchTypes(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	results, err := client.Search("test", spotify.SearchOptions{Types: []string{"album", "artist", "show", "episode"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Tracks) != 0 || len(results.Playlists) != 0 {
+		t.Errorf("got %d tracks and %d playlists, want none", len(results.Tracks), len(results.Playlists))
+	}
+
+	var got []string
+	for _, item := range results.Items() {
+		got = append(got, item.Type+":"+item.Name)
+	}
+	want := []string{"album:First Light", "artist:The Testers", "show:Testing Talk"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got items %v, want %v", got, want)
+	}
+	if genres := results.Artists[0].Genres; len(genres) != 1 || genres[0] != "indie rock" {
+		t.Errorf("got genres %v, want [indie rock]", genres)
+	}
+	if results.Shows[0].Publisher != "Fake Radio" || results.Shows[0].TotalEpisodes != 2 {
+		t.Errorf("got show %+v", results.Shows[0])
+	}
+
+	if _, err := client.Search("test", spotify.SearchOptions{Types: []string{"podcast"}}); err == nil {
+		t.Error("Search with type podcast succeeded, want error")
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	first, err := client.Search("hello", spotify.SearchOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Tracks) != 2 || first.Total != 3 || first.Next == "" || first.Previous != "" {
+		t.Fatalf("got %d tracks of %d, next %q, previous %q", len(first.Tracks), first.Total, first.Next, first.Previous)
+	}
+
+	second, err := client.SearchPage(first.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Tracks) != 1 || second.Tracks[0].Name != "Hello Goodbye" || second.Offset != 2 {
+		t.Errorf("got tracks %+v at offset %d, want Hello Goodbye at 2", second.Tracks, second.Offset)
+	}
+	if second.Next != "" || second.Previous == "" {
+		t.Errorf("got next %q, previous %q on the last page", second.Next, second.Previous)
+	}
+
+	back, err := client.SearchPage(second.Previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Tracks) != 2 || back.Tracks[0].Name != first.Tracks[0].Name {
+		t.Errorf("got tracks %+v, want the first page again", back.Tracks)
+	}
+
+	// Links elsewhere are not followed with the access token
+	if _, err := client.SearchPage("https://example.com/v1/search?q=hello"); err == nil {
+		t.Error("SearchPage followed a foreign link")
+	}
+	if _, err := client.Search("hello", spotify.SearchOptions{Limit: 51}); err == nil {
+		t.Error("Search with limit 51 succeeded, want error")
+	}
+}
+
+func TestShowNewReleasesAndPlayAlbum(t *testing.T) {
+	client, server := newTestClient(t)
+
+	releases, err := client.GetNewReleases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases.Albums) != 2 || releases.Albums[0].Name != "Faking It" {
+		t.Fatalf("got new releases %+v", releases.Albums)
+	}
+
+	if _, err := client.PlayAlbum(releases.Albums[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	state := server.State()
+	if !state.IsPlaying || state.ContextURI != "spotify:album:album3" {
+		t.Errorf("got playing=%v context=%q, want album3 playing", state.IsPlaying, state.ContextURI)
+	}
+}
+
+func TestListPlaylistsAndPlayPlaylist(t *testing.T) {
+	client, server := newTestClient(t)
+
+	playlists, err := client.ListPlaylists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlists.Items) != 3 {
+		t.Fatalf("got %d playlists, want 3", len(playlists.Items))
+	}
+
+	if _, err := client.PlayPlaylist(playlists.Items[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	state := server.State()
+	if state.ContextURI != "spotify:playlist:playlist2" || len(state.Tracks) != 3 {
+		t.Errorf("got context %q with %d tracks, want playlist2 with 3", state.ContextURI, len(state.Tracks))
+	}
+}
+
+func TestPlayTrack(t *testing.T) {
+	client, server := newTestClient(t)
+
+	if _, err := client.PlayTrack("spotify:track:album2-track3"); err != nil {
+		t.Fatal(err)
+	}
+
+	item, ok := server.State().Item()
+	if !ok || item.Name != "Finale" {
+		t.Errorf("got item %+v, want Finale", item)
+	}
+	// A selected device that is not found is reported rather than falling
+	// back to the browser
+	client.Device = "Kitchen"
+	if playback, err := client.PlayTrack("spotify:track:album2-track1"); err == nil || playback.Browser != "" {
+		t.Errorf("got %+v, %v; want an error for the missing device", playback, err)
+	}
+}
+
+func TestPlayContextURI(t *testing.T) {
+	client, server := newTestClient(t)
+
+	// Artists and shows are played as a context rather than as a track list
+	for _, uri := range []string{"spotify:artist:artist2", "spotify:show:show1"} {
+		parsed, _ := spotify.ParseURI(uri)
+		if _, err := client.PlayURI(parsed); err != nil {
+			t.Fatal(err)
+		}
+		if state := server.State(); state.ContextURI != uri {
+			t.Errorf("got context %q, want %q", state.ContextURI, uri)
+		}
+	}
+}
+
+func TestPlaybackControls(t *testing.T) {
+	client, server := newTestClient(t)
+
+	playing, err := client.TogglePlayback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !playing || !server.State().IsPlaying {
+		t.Error("toggle did not start playback")
+	}
+	playing, err = client.TogglePlayback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playing || server.State().IsPlaying {
+		t.Error("toggle did not pause playback")
+	}
+
+	if err := client.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SkipToPrevious(); err != nil {
+		t.Fatal(err)
+	}
+	if index := server.State().Index; index != 1 {
+		t.Errorf("got track index %d, want 1", index)
+	}
+
+	if err := client.SetVolume(35); err != nil {
+		t.Fatal(err)
+	}
+	device, _ := server.State().ActiveDevice()
+	if device.VolumePercent != 35 {
+		t.Errorf("got volume %d, want 35", device.VolumePercent)
+	}
+	if err := client.SetVolume(101); err == nil {
+		t.Error("SetVolume(101) succeeded, want error")
+	}
+}
+
+func TestRepeatModes(t *testing.T) {
+	client, server := newTestClient(t)
+
+	mode, err := client.SetRepeatMode("album")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repeat := server.State().Repeat; mode != "context" || repeat != "context" {
+		t.Errorf("got mode %q and repeat %q after album, want context", mode, repeat)
+	}
+
+	mode, err = client.ToggleRepeat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repeat := server.State().Repeat; mode != "off" || repeat != "off" {
+		t.Errorf("got mode %q and repeat %q after toggle, want off", mode, repeat)
+	}
+
+	if _, err := client.SetRepeatMode("sometimes"); err == nil {
+		t.Error("SetRepeatMode(sometimes) succeeded, want error")
+	}
+
+	mode, err = client.GetRepeatMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "off" {
+		t.Errorf("got repeat mode %q, want off", mode)
+	}
+}
+
+func TestGetPlaybackState(t *testing.T) {
+	client, server := newTestClient(t)
+
+	if err := client.SetVolume(64); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := client.GetPlaybackState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.Item == nil {
+		t.Fatal("got no playback state, want the loaded album")
+	}
+	want, _ := server.State().Item()
+	if state.Item.Name != want.Name || state.Item.Duration != want.DurationMs {
+		t.Errorf("got item %q (%d ms), want %q (%d ms)", state.Item.Name, state.Item.Duration, want.Name, want.DurationMs)
+	}
+	if state.Device.Name != "Test Laptop" || state.Device.VolumePercent != 64 {
+		t.Errorf("got device %+v, want Test Laptop at 64%%", state.Device)
+	}
+	if state.Context == nil || state.Context.URI != "spotify:album:album1" {
+		t.Errorf("got context %+v, want album1", state.Context)
+	}
+}
+
+func TestNoActiveDevice(t *testing.T) {
+	client, server := newTestClient(t)
+	server.SetDevices([]spotifytest.Device{{ID: "device2", Name: "Test Phone", Type: "Smartphone"}})
+
+	if _, err := client.TogglePlayback(); !errors.Is(err, spotify.ErrNoActiveDevice) {
+		t.Errorf("TogglePlayback: got %v, want ErrNoActiveDevice", err)
+	}
+	if state, err := client.GetPlaybackState(); err != nil || state != nil {
+		t.Errorf("GetPlaybackState: got %+v, %v; want nil, nil", state, err)
+	}
+	if err := client.SkipToNext(); !errors.Is(err, spotify.ErrNoActiveDevice) {
+		t.Errorf("SkipToNext: got %v, want ErrNoActiveDevice", err)
+	}
+}
+
+func TestResolveDevice(t *testing.T) {
+	client, server := newTestClient(t)
+
+	tests := []struct {
+		device, defaultDevice string
+		want                  string // name of the resolved device, or "" for an error
+	}{
+		{"", "", "Test Laptop"},
+		{"", "test phone", "Test Phone"},
+		{"", "Kitchen", "Test Laptop"},
+		{"device2", "", "Test Phone"},
+		{"phone", "Test Laptop", "Test Phone"},
+		{"test", "", ""},
+		{"Kitchen", "", ""},
+	}
+	for _, tt := range tests {
+		client.Device, client.DefaultDevice = tt.device, tt.defaultDevice
+		device, err := client.ResolveDevice()
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("device %q: got %s, want error", tt.device, device.Name)
+			}
+			continue
+		}
+		if err != nil || device.Name != tt.want {
+			t.Errorf("device %q, default %q: got %q, %v; want %s", tt.device, tt.defaultDevice, device.Name, err, tt.want)
+		}
+	}
+
+	// Playback starts on the selected device
+	client.Device, client.DefaultDevice = "Test Phone", ""
+	playback, err := client.PlayAlbum("album1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device, _ := server.State().ActiveDevice(); device.ID != "device2" || playback.Device.ID != "device2" {
+		t.Errorf("playing on %s, reported %s; want device2", device.ID, playback.Device.ID)
+	}
+
+	// Restricted devices are never picked
+	server.SetDevices([]spotifytest.Device{{ID: "device3", Name: "Speaker", IsActive: true, IsRestricted: true}})
+	client.Device = ""
+	if _, err := client.ResolveDevice(); !errors.Is(err, spotify.ErrNoActiveDevice) {
+		t.Errorf("got %v with only a restricted device, want ErrNoActiveDevice", err)
+	}
+	client.Device = "Speaker"
+	if _, err := client.ResolveDevice(); err == nil {
+		t.Error("selected a restricted device")
+	}
+}
+
+func TestFindDevice(t *testing.T) {
+	devices := []spotify.Device{
+		{ID: "a", Name: "Kitchen Speaker"},
+		{ID: "b", Name: "Living Room TV"},
+		{ID: "c", Name: "Living-Room Speaker"},
+	}
+	tests := []struct {
+		name string
+		want string // ID of the device found, or "" for an error
+	}{
+		{"b", "b"},
+		{"kitchen speaker", "a"},
+		{"kit", "a"},
+		{"tv", "b"},
+		{"ktchn", "a"},
+		{"livingroom s", "c"},
+		{"speaker", ""},
+		{"living", ""},
+		{"garage", ""},
+		{"--", ""},
+	}
+	for _, tt := range tests {
+		device, err := spotify.FindDevice(devices, tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("FindDevice(%q) = %s, want error", tt.name, device.Name)
+			}
+			continue
+		}
+		if err != nil || device.ID != tt.want {
+			t.Errorf("FindDevice(%q) = %q, %v; want %s", tt.name, device.ID, err, tt.want)
+		}
+	}
+}
+
+func TestTransferPlayback(t *testing.T) {
+	client, server := newTestClient(t)
+
+	phone := spotify.Device{ID: "device2", Name: "Test Phone"}
+	state, err := client.TransferPlayback(phone, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Device.ID != "device2" || state.IsPlaying {
+		t.Errorf("got device %s, playing %v; want device2, paused", state.Device.ID, state.IsPlaying)
+	}
+
+	laptop := spotify.Device{ID: "device1", Name: "Test Laptop"}
+	if state, err = client.TransferPlayback(laptop, true); err != nil {
+		t.Fatal(err)
+	}
+	if !state.IsPlaying || !server.State().IsPlaying {
+		t.Error("transfer with play did not start playback")
+	}
+
+	if _, err := client.TransferPlayback(spotify.Device{ID: "device9", Name: "Gone"}, false); !spotify.IsStatus(err, http.StatusNotFound) {
+		t.Errorf("got %v for a missing device, want a 404", err)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	client, server := newTestClient(t)
+
+	if err := client.AddToQueue("spotify:track:album3-track1"); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := client.Enqueue(spotify.SpotifyURI{Type: "playlist", ID: "playlist1"}); err != nil || count != 3 {
+		t.Fatalf("queued %d tracks of a playlist, %v; want 3", count, err)
+	}
+	if _, err := client.Enqueue(spotify.SpotifyURI{Type: "artist", ID: "artist1"}); err == nil {
+		t.Error("queued an artist")
+	}
+
+	// Queued tracks come before the rest of the playing album
+	queue, err := client.GetQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.CurrentlyPlaying == nil || queue.CurrentlyPlaying.Name != "Hello World" {
+		t.Errorf("got currently playing %+v, want Hello World", queue.CurrentlyPlaying)
+	}
+	var names []string
+	for _, track := range queue.Queue {
+		names = append(names, track.Name)
+	}
+	want := "Pretend, Hello World, Hello Again, Hello Goodbye, Green Tests, Red Tests"
+	if got := strings.Join(names, ", "); got != want {
+		t.Errorf("got queue %s, want %s", got, want)
+	}
+
+	if err := client.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	state := server.State()
+	if track, _ := state.Item(); track.Name != "Pretend" || len(state.Queue) != 3 {
+		t.Errorf("playing %s with %d queued, want Pretend with 3", track.Name, len(state.Queue))
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	client, server := newTestClient(t)
+
+	state, err := client.SetShuffle(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.ShuffleState || !server.State().Shuffle {
+		t.Error("shuffle is not on")
+	}
+	if state, err = client.ToggleShuffle(); err != nil || state.ShuffleState {
+		t.Errorf("toggled shuffle to %v, %v; want off", state != nil && state.ShuffleState, err)
+	}
+
+	// Shuffle is turned on on the device that starts playing
+	client.Device = "Test Phone"
+	if _, err := client.PlayShuffled(spotify.SpotifyURI{Type: "playlist", ID: "playlist2"}); err != nil {
+		t.Fatal(err)
+	}
+	playing := server.State()
+	if device, _ := playing.ActiveDevice(); device.ID != "device2" || !playing.Shuffle || playing.ContextURI != "spotify:playlist:playlist2" {
+		t.Errorf("playing %s on %s with shuffle %v", playing.ContextURI, device.ID, playing.Shuffle)
+	}
+	if _, err := client.PlayShuffled(spotify.SpotifyURI{Type: "track", ID: "album1-track1"}); err == nil {
+		t.Error("played a track shuffled")
+	}
+}
+
+func TestVolumeChanges(t *testing.T) {
+	client, server := newTestClient(t)
+	volume := func() int {
+		device, _ := server.State().ActiveDevice()
+		return device.VolumePercent
+	}
+
+	if got, err := client.ChangeVolume(10); err != nil || got != 60 || volume() != 60 {
+		t.Errorf("ChangeVolume(10) = %d, %v with the server at %d; want 60", got, err, volume())
+	}
+	if got, err := client.ChangeVolume(-100); err != nil || got != 0 {
+		t.Errorf("ChangeVolume(-100) = %d, %v; want 0", got, err)
+	}
+
+	// A fade of a second takes two steps
+	if got, err := client.Fade(context.Background(), 80, time.Second); err != nil || got != 80 || volume() != 80 {
+		t.Errorf("Fade = %d, %v with the server at %d; want 80", got, err, volume())
+	}
+	requests := strings.Join(server.Requests(), "\n")
+	if !strings.Contains(requests, "volume_percent=40") {
+		t.Errorf("the fade did not pass 40%%:\n%s", requests)
+	}
+
+	// A stopped fade leaves the volume as it is
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got, err := client.Fade(ctx, 0, time.Minute); !errors.Is(err, context.Canceled) || got != 80 || volume() != 80 {
+		t.Errorf("stopped Fade = %d, %v with the server at %d; want 80", got, err, volume())
+	}
+}
+
+func TestSleepTimer(t *testing.T) {
+	client, server := newTestClient(t)
+
+	target, _ := spotify.ParseSeekTarget("1:00")
+	if _, err := client.Seek(target); err != nil {
+		t.Fatal(err)
+	}
+	if left, err := client.TrackTimeLeft(); err != nil || left != 2*time.Minute {
+		t.Errorf("TrackTimeLeft = %v, %v; want 2m", left, err)
+	}
+	// The rest of Hello World, then Green Tests and Red Tests
+	if left, err := client.AlbumTimeLeft(); err != nil || left != 525*time.Second {
+		t.Errorf("AlbumTimeLeft = %v, %v; want 8m45s", left, err)
+	}
+	if _, err := client.SetShuffle(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AlbumTimeLeft(); err == nil {
+		t.Error("AlbumTimeLeft succeeded with shuffle on")
+	}
+
+	// A stopped timer leaves playback alone
+	if _, err := client.TogglePlayback(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Sleep(ctx, time.Minute, spotify.SleepFade); !errors.Is(err, context.Canceled) || !server.State().IsPlaying {
+		t.Errorf("stopped Sleep: %v, playing %v", err, server.State().IsPlaying)
+	}
+
+	// The volume fades out over a second, then is restored once paused
+	if err := client.Sleep(context.Background(), time.Second, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	state := server.State()
+	if device, _ := state.ActiveDevice(); state.IsPlaying || device.VolumePercent != 50 {
+		t.Errorf("playing %v at volume %d after Sleep, want paused at 50", state.IsPlaying, device.VolumePercent)
+	}
+	if requests := strings.Join(server.Requests(), "\n"); !strings.Contains(requests, "volume_percent=0") {
+		t.Errorf("the volume did not fade out:\n%s", requests)
+	}
+
+	// The volume is restored when pausing fails after the fade
+	if _, err := client.TogglePlayback(); err != nil {
+		t.Fatal(err)
+	}
+	server.FailRequest("PUT", "/me/player/pause", 0, http.StatusForbidden)
+	if err := client.Sleep(context.Background(), time.Second, time.Second); !spotify.IsStatus(err, http.StatusForbidden) {
+		t.Errorf("got error %v, want the failed pause", err)
+	}
+	state = server.State()
+	if device, _ := state.ActiveDevice(); !state.IsPlaying || device.VolumePercent != 50 {
+		t.Errorf("playing %v at volume %d after a failed pause, want playing at 50", state.IsPlaying, device.VolumePercent)
+	}
+}
+
+func TestExpiredTokenIsRefreshedAndReplayed(t *testing.T) {
+	client, server := newTestClient(t)
+	before := client.Token().AccessToken
+
+	server.ExpireTokens()
+	if err := client.SetVolume(20); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Token().AccessToken == before {
+		t.Error("access token was not refreshed")
+	}
+	requests := server.Requests()
+	if len(requests) != 2 || requests[0] != requests[1] {
+		t.Errorf("got requests %v, want the same request twice", requests)
+	}
+	device, _ := server.State().ActiveDevice()
+	if device.VolumePercent != 20 {
+		t.Errorf("got volume %d, want 20", device.VolumePercent)
+	}
+}
+
+func TestRateLimitedRequestIsRetried(t *testing.T) {
+	client, server := newTestClient(t)
+
+	server.FailNext(2, http.StatusTooManyRequests, "0")
+	results, err := client.SearchTracks("turtle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Tracks) != 1 {
+		t.Errorf("got %d tracks, want 1", len(results.Tracks))
+	}
+	if requests := server.Requests(); len(requests) != 3 {
+		t.Errorf("got %d requests, want 3", len(requests))
+	}
+}
+
+func TestServerErrorIsOnlyRetriedForIdempotentRequests(t *testing.T) {
+	client, server := newTestClient(t)
+
+	// A POST may have taken effect, and adding to the queue twice would queue
+	// the track twice
+	server.FailNext(1, http.StatusServiceUnavailable, "")
+	if err := client.AddToQueue("spotify:track:album1-track2"); !spotify.IsStatus(err, http.StatusServiceUnavailable) {
+		t.Errorf("got error %v, want a 503 APIError", err)
+	}
+	if requests := server.Requests(); len(requests) != 1 {
+		t.Errorf("got requests %v, want 1", requests)
+	}
+
+	// A rate-limited POST was not processed, so it is retried
+	server.FailNext(1, http.StatusTooManyRequests, "0")
+	if err := client.AddToQueue("spotify:track:album1-track2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A PUT is retried
+	server.FailNext(1, http.StatusServiceUnavailable, "")
+	if err := client.SetVolume(30); err != nil {
+		t.Fatal(err)
+	}
+	if requests := server.Requests(); len(requests) != 5 {
+		t.Errorf("got requests %v, want 5", requests)
+	}
+}
+
+func TestAPIErrorIsTyped(t *testing.T) {
+	client, server := newTestClient(t)
+
+	server.FailNext(1, http.StatusForbidden, "")
+	_, err := client.SetRepeatMode("off")
+	if !spotify.IsStatus(err, http.StatusForbidden) {
+		t.Errorf("got error %v, want a 403 APIError", err)
+	}
+}
@@ -0,0 +1,77 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config holds the settings kept between sessions
+type Config struct {
+	// DefaultDevice is the name of the device to play on when none is selected
+	DefaultDevice string `json:"default_device,omitempty"`
+	// MutedVolume is the volume to restore on unmute; 0 when not muted
+	MutedVolume int `json:"muted_volume,omitempty"`
+}
+
+// ConfigDir returns $XDG_CONFIG_HOME/spotify-cli, defaulting to ~/.config/spotify-cli
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "spotify-cli"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding home directory: %v", err)
+	}
+	return filepath.Join(home, ".config", "spotify-cli"), nil
+}
+
+// ConfigPath returns the path of the config file in ConfigDir
+func ConfigPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// LoadConfig reads the config file at path. A missing file is an empty config.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("error reading config file: %v", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Save writes the config file at path
+func (c Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating config directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated config
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	return nil
+}
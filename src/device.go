@@ -0,0 +1,178 @@
+package spotify
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// ResolveDevice returns the device to start playback on: the selected Device,
+// which must be available, else the DefaultDevice if it is available, else the
+// active device, a web player or the first device. Restricted devices do not
+// accept remote control and are never picked. It returns ErrNoActiveDevice
+// when there is no device to play on.
+func (c *SpotifyClient) ResolveDevice() (Device, error) {
+	devices, err := c.GetDevices()
+	if err != nil {
+		return Device{}, err
+	}
+
+	if c.Device != "" {
+		device, err := FindDevice(devices, c.Device)
+		if err == nil && device.IsRestricted {
+			err = fmt.Errorf("device %s does not accept remote control", device.Name)
+		}
+		return device, err
+	}
+
+	var available []Device
+	for _, device := range devices {
+		if !device.IsRestricted {
+			available = append(available, device)
+		}
+	}
+	if len(available) == 0 {
+		return Device{}, ErrNoActiveDevice
+	}
+
+	if c.DefaultDevice != "" {
+		if device, err := FindDevice(available, c.DefaultDevice); err == nil {
+			return device, nil
+		}
+	}
+	for _, device := range available {
+		if device.IsActive {
+			return device, nil
+		}
+	}
+	for _, device := range available {
+		if strings.Contains(strings.ToLower(device.Name), "web player") {
+			return device, nil
+		}
+	}
+	return available[0], nil
+}
+
+// FindDevice returns the device with the given ID or name, ignoring case, or
+// else the only device whose name starts with, contains or spells out it in
+// order, ignoring spaces and punctuation: "kit", "speaker" and "ktchn" all
+// find "Kitchen Speaker"
+func FindDevice(devices []Device, name string) (Device, error) {
+	for _, device := range devices {
+		if device.ID == name || strings.EqualFold(device.Name, name) {
+			return device, nil
+		}
+	}
+
+	folded := foldName(name)
+	if folded == "" {
+		return Device{}, fmt.Errorf("no device named %s. Available devices: %s", name, deviceNames(devices))
+	}
+	for _, match := range []func(string) bool{
+		func(deviceName string) bool { return strings.HasPrefix(deviceName, folded) },
+		func(deviceName string) bool { return strings.Contains(deviceName, folded) },
+		func(deviceName string) bool { return isSubsequence(folded, deviceName) },
+	} {
+		var found []Device
+		for _, device := range devices {
+			if match(foldName(device.Name)) {
+				found = append(found, device)
+			}
+		}
+		if len(found) == 1 {
+			return found[0], nil
+		}
+		if len(found) > 1 {
+			return Device{}, fmt.Errorf("%s matches several devices: %s", name, deviceNames(found))
+		}
+	}
+	return Device{}, fmt.Errorf("no device named %s. Available devices: %s", name, deviceNames(devices))
+}
+
+// foldName lowercases a device name and drops everything but letters and digits
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// isSubsequence reports whether the runes of sub appear in s in order
+func isSubsequence(sub, s string) bool {
+	rest := []rune(sub)
+	for _, r := range s {
+		if len(rest) > 0 && rest[0] == r {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
+
+// deviceNames returns the names of the devices as a comma-separated list
+func deviceNames(devices []Device) string {
+	names := make([]string, len(devices))
+	for i, device := range devices {
+		names[i] = device.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// startPlayback plays uri on the resolved device, shuffled if asked. Albums,
+// artists, playlists and shows are played as a context, tracks and episodes on
+// their own. It returns the device that plays.
+func (c *SpotifyClient) startPlayback(uri string, shuffle bool) (Device, error) {
+	device, err := c.ResolveDevice()
+	if err != nil {
+		return Device{}, err
+	}
+
+	// Shuffle is set first so that the first track is already a random one
+	if shuffle {
+		if _, err := c.do("PUT", "/me/player/shuffle?state=true&device_id="+url.QueryEscape(device.ID), nil, nil); err != nil {
+			return Device{}, fmt.Errorf("error turning on shuffle: %w", err)
+		}
+	}
+
+	var playBody map[string]interface{}
+	if parsed, err := ParseURI(uri); err == nil && parsed.IsContext() {
+		playBody = map[string]interface{}{"context_uri": uri}
+	} else {
+		playBody = map[string]interface{}{"uris": []string{uri}}
+	}
+
+	if _, err := c.do("PUT", "/me/player/play?device_id="+url.QueryEscape(device.ID), playBody, nil); err != nil {
+		return Device{}, fmt.Errorf("play request failed: %w", err)
+	}
+	return device, nil
+}
+
+// TransferPlayback moves playback to the device, starting it when play is set
+// and otherwise keeping the current play or pause state. It returns the player
+// state read back once the device has become active.
+func (c *SpotifyClient) TransferPlayback(device Device, play bool) (*PlaybackState, error) {
+	if device.IsRestricted {
+		return nil, fmt.Errorf("device %s does not accept remote control", device.Name)
+	}
+
+	body := map[string]interface{}{
+		"device_ids": []string{device.ID},
+		"play":       play,
+	}
+	if _, err := c.do("PUT", "/me/player", body, nil); err != nil {
+		return nil, fmt.Errorf("transfer request failed: %w", err)
+	}
+
+	state, ok, err := c.awaitState(func(state *PlaybackState) bool {
+		return state.Device.ID == device.ID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("playback did not move to %s", device.Name)
+	}
+	return state, nil
+}
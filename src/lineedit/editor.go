@@ -0,0 +1,413 @@
+// Package lineedit reads lines from a terminal with Emacs-style editing keys,
+// history navigation, reverse search and tab completion. When the input is not
+// a terminal, or raw mode is not supported, lines are read as typed.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when the line is abandoned with Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// Completer returns the completions of the word before the cursor. head is the
+// text before the cursor and start is the byte offset in head where the word
+// begins; a completion replaces head[start:].
+type Completer func(head string) (candidates []string, start int)
+
+// Key codes
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Escape sequences are mapped to private values outside the Unicode range
+const (
+	keyUp rune = utf8.MaxRune + 1 + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDeleteForward
+)
+
+// Editor reads lines from a terminal
+type Editor struct {
+	History  *History
+	Complete Completer
+
+	r  *bufio.Reader
+	w  io.Writer
+	fd int // terminal file descriptor, or -1 when the input is not a terminal
+
+	pending rune // key read ahead by the reverse search, or 0
+}
+
+// New returns an Editor reading from in and echoing to out
+func New(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{History: &History{}, r: bufio.NewReader(in), w: out, fd: -1}
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		e.fd = int(f.Fd())
+	}
+	return e
+}
+
+// ReadLine shows the prompt and returns the entered line without its newline.
+// It returns io.EOF at the end of input or on Ctrl-D in an empty line, and
+// ErrInterrupted on Ctrl-C. Lines typed at a terminal are added to the history.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.fd < 0 {
+		return e.readPlain(prompt)
+	}
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	line, err := e.edit(prompt)
+	restore()
+
+	if err == nil {
+		// The history file is a convenience, so failing to save it is not an error
+		e.History.Add(line)
+	}
+	return line, err
+}
+
+// readPlain reads a line without editing, e.g. from a pipe
+func (e *Editor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.w, prompt)
+	line, err := e.r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// line is the state of the line being edited
+type line struct {
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func (l *line) insert(s string) {
+	runes := []rune(s)
+	l.buf = append(l.buf[:l.pos], append(runes, l.buf[l.pos:]...)...)
+	l.pos += len(runes)
+}
+
+func (l *line) set(s string) {
+	l.buf = []rune(s)
+	l.pos = len(l.buf)
+}
+
+// edit reads keys until the line is entered, with the terminal in raw mode
+func (e *Editor) edit(prompt string) (string, error) {
+	l := &line{prompt: prompt}
+	entries := e.History.Entries()
+	index := len(entries) // position in the history; len(entries) is the new line
+	var draft string      // the new line while browsing the history
+	lastTab := false
+
+	e.refresh(l)
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		tab := false
+		switch key {
+		case keyEnter, keyLineFeed:
+			fmt.Fprint(e.w, "\n")
+			return string(l.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.w, "^C\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(l.buf) == 0 {
+				fmt.Fprint(e.w, "\n")
+				return "", io.EOF
+			}
+			if l.pos < len(l.buf) {
+				l.buf = append(l.buf[:l.pos], l.buf[l.pos+1:]...)
+			}
+		case keyDeleteForward:
+			if l.pos < len(l.buf) {
+				l.buf = append(l.buf[:l.pos], l.buf[l.pos+1:]...)
+			}
+		case keyBackspace, keyDelete:
+			if l.pos > 0 {
+				l.buf = append(l.buf[:l.pos-1], l.buf[l.pos:]...)
+				l.pos--
+			}
+		case keyCtrlA, keyHome:
+			l.pos = 0
+		case keyCtrlE, keyEnd:
+			l.pos = len(l.buf)
+		case keyCtrlB, keyLeft:
+			if l.pos > 0 {
+				l.pos--
+			}
+		case keyCtrlF, keyRight:
+			if l.pos < len(l.buf) {
+				l.pos++
+			}
+		case keyCtrlK:
+			l.buf = l.buf[:l.pos]
+		case keyCtrlU:
+			l.buf = l.buf[l.pos:]
+			l.pos = 0
+		case keyCtrlW:
+			start := l.pos
+			for start > 0 && l.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && l.buf[start-1] != ' ' {
+				start--
+			}
+			l.buf = append(l.buf[:start], l.buf[l.pos:]...)
+			l.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.w, "\x1b[H\x1b[2J")
+		case keyCtrlP, keyUp:
+			if index > 0 {
+				if index == len(entries) {
+					draft = string(l.buf)
+				}
+				index--
+				l.set(entries[index])
+			}
+		case keyCtrlN, keyDown:
+			if index < len(entries) {
+				index++
+				if index == len(entries) {
+					l.set(draft)
+				} else {
+					l.set(entries[index])
+				}
+			}
+		case keyTab:
+			tab = true
+			e.complete(l, lastTab)
+		case keyCtrlR:
+			e.reverseSearch(l, entries)
+		default:
+			if key >= ' ' && key <= utf8.MaxRune {
+				l.insert(string(key))
+			}
+		}
+		lastTab = tab
+		e.refresh(l)
+	}
+}
+
+// readKey reads one key, translating escape sequences
+func (e *Editor) readKey() (rune, error) {
+	if e.pending != 0 {
+		key := e.pending
+		e.pending = 0
+		return key, nil
+	}
+
+	r, _, err := e.r.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	// Escape sequences are ESC [ or ESC O, optional digits and a final character
+	r, _, err = e.r.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return keyEscape, err
+	}
+	var params strings.Builder
+	for {
+		r, _, err = e.r.ReadRune()
+		if err != nil {
+			return keyEscape, err
+		}
+		if (r < '0' || r > '9') && r != ';' {
+			break
+		}
+		params.WriteRune(r)
+	}
+
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch params.String() {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDeleteForward, nil
+		}
+	}
+	return keyEscape, nil
+}
+
+// refresh redraws the prompt and line and places the cursor
+func (e *Editor) refresh(l *line) {
+	fmt.Fprintf(e.w, "\r%s%s\x1b[K", l.prompt, string(l.buf))
+	if back := len(l.buf) - l.pos; back > 0 {
+		fmt.Fprintf(e.w, "\x1b[%dD", back)
+	}
+}
+
+// complete replaces the word before the cursor with its completion. When there
+// are several, it completes their common prefix, and lists them on a second Tab.
+func (e *Editor) complete(l *line, listed bool) {
+	if e.Complete == nil {
+		return
+	}
+	head := string(l.buf[:l.pos])
+	tail := string(l.buf[l.pos:])
+	candidates, start := e.Complete(head)
+	if start < 0 || start > len(head) {
+		return
+	}
+	word := head[start:]
+
+	var replacement string
+	switch {
+	case len(candidates) == 0:
+		fmt.Fprint(e.w, "\a")
+		return
+	case len(candidates) == 1:
+		replacement = candidates[0]
+		if !strings.HasPrefix(tail, " ") {
+			replacement += " "
+		}
+	default:
+		replacement = commonPrefix(candidates)
+		if len(replacement) <= len(word) {
+			if listed {
+				fmt.Fprintf(e.w, "\n%s\n", strings.Join(candidates, "  "))
+			} else {
+				fmt.Fprint(e.w, "\a")
+			}
+			return
+		}
+	}
+
+	head = head[:start] + replacement
+	l.buf = []rune(head + tail)
+	l.pos = utf8.RuneCountInString(head)
+}
+
+// commonPrefix returns the longest prefix shared by all the strings
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// reverseSearch searches the history backwards for lines containing the typed
+// text. Ctrl-R moves to an older match, Ctrl-G cancels, and any other control
+// key accepts the match and is then handled as usual.
+func (e *Editor) reverseSearch(l *line, entries []string) {
+	original := string(l.buf)
+	var query []rune
+	match := len(entries)
+	failing := false
+
+	// search looks for the query in the entries before from, newest first
+	search := func(from int) {
+		for i := from - 1; i >= 0; i-- {
+			if strings.Contains(entries[i], string(query)) {
+				match = i
+				failing = false
+				return
+			}
+		}
+		failing = true
+	}
+
+	for {
+		label := "reverse-i-search"
+		if failing {
+			label = "failing " + label
+		}
+		text := ""
+		if match < len(entries) {
+			text = entries[match]
+		}
+		fmt.Fprintf(e.w, "\r(%s)`%s': %s\x1b[K", label, string(query), text)
+
+		key, err := e.readKey()
+		if err != nil {
+			l.set(original)
+			return
+		}
+		switch {
+		case key == keyCtrlR:
+			if len(query) > 0 {
+				search(match)
+			}
+		case key == keyCtrlG || key == keyCtrlC:
+			l.set(original)
+			return
+		case key == keyBackspace || key == keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match = len(entries)
+				search(len(entries))
+			}
+		case key >= ' ' && key <= utf8.MaxRune:
+			query = append(query, key)
+			if match == len(entries) {
+				search(len(entries))
+			} else {
+				search(match + 1)
+			}
+		default:
+			if match < len(entries) {
+				l.set(entries[match])
+			}
+			e.pending = key
+			return
+		}
+	}
+}
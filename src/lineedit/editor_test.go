@@ -0,0 +1,176 @@
+package lineedit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestEditor returns an Editor that edits the typed keys as if they came from a terminal
+func newTestEditor(keys string, history ...string) *Editor {
+	e := New(strings.NewReader(keys), &bytes.Buffer{})
+	e.History = &History{entries: history}
+	return e
+}
+
+func TestEditKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"typing", "search hello\r", "search hello"},
+		{"backspace", "searcx\x7fh\r", "search"},
+		{"insert at start", "lay\x01p\r", "play"},
+		{"arrows", "nxt\x1b[D\x1b[De\x1b[C\r", "next"},
+		{"delete key", "nexxt\x1b[D\x1b[D\x1b[3~\r", "next"},
+		{"kill to end", "volume 40\x01\x06\x06\x06\x06\x06\x06\x0b\r", "volume"},
+		{"kill word", "search daft punk\x17\x17hello\r", "search hello"},
+		{"kill line", "garbage\x15next\r", "next"},
+		{"unicode", "search café\x7fe\r", "search cafe"},
+	}
+	for _, tt := range tests {
+		got, err := newTestEditor(tt.keys).edit("> ")
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestEditEndOfInputAndInterrupt(t *testing.T) {
+	if _, err := newTestEditor("\x04").edit("> "); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line: got %v, want io.EOF", err)
+	}
+	if got, err := newTestEditor("nexts\x02\x04\r").edit("> "); err != nil || got != "next" {
+		t.Errorf("Ctrl-D in a line: got %q, %v; want it to delete forward", got, err)
+	}
+	if _, err := newTestEditor("search\x03").edit("> "); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Ctrl-C: got %v, want ErrInterrupted", err)
+	}
+}
+
+func TestEditHistory(t *testing.T) {
+	history := []string{"search hello", "play 2", "next"}
+
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"previous", "\x1b[A\r", "next"},
+		{"oldest", "\x10\x10\x10\x10\r", "search hello"},
+		{"back to draft", "vol\x1b[A\x1b[A\x1b[B\x1b[B\r", "vol"},
+		{"reverse search", "\x12hel\r", "search hello"},
+		{"older match", "\x12e\x12\r", "search hello"},
+		{"edit match", "\x12pl\x05 3\r", "play 2 3"},
+		{"cancel search", "vol\x12pl\x07\r", "vol"},
+	}
+	for _, tt := range tests {
+		got, err := newTestEditor(tt.keys, history...).edit("> ")
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestEditCompletion(t *testing.T) {
+	complete := func(head string) ([]string, int) {
+		start := strings.LastIndex(head, " ") + 1
+		var matches []string
+		for _, candidate := range []string{"play", "play-new", "play-list", "playlists", "prev"} {
+			if strings.HasPrefix(candidate, head[start:]) {
+				matches = append(matches, candidate)
+			}
+		}
+		return matches, start
+	}
+
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"pr\t\r", "prev "},
+		{"play-n\t3\r", "play-new 3"},
+		{"pla\t\r", "play"},
+		{"x\t\r", "x"},
+	}
+	for _, tt := range tests {
+		e := newTestEditor(tt.keys)
+		e.Complete = complete
+		got, err := e.edit("> ")
+		if err != nil || got != tt.want {
+			t.Errorf("keys %q: got %q, %v; want %q", tt.keys, got, err, tt.want)
+		}
+	}
+
+	// A second Tab without progress lists the candidates
+	var out bytes.Buffer
+	e := New(strings.NewReader("play\t\t\r"), &out)
+	e.Complete = complete
+	if _, err := e.edit("> "); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "play  play-new  play-list  playlists") {
+		t.Errorf("candidates were not listed:\n%q", out.String())
+	}
+}
+
+func TestReadLineWithoutTerminal(t *testing.T) {
+	// A pipe is no terminal, so lines are read as typed, as on platforms
+	// without raw terminal mode
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.WriteString("search hello\r\nnext\n")
+	w.Close()
+
+	var out bytes.Buffer
+	e := New(r, &out)
+	if e.fd != -1 {
+		t.Fatal("a pipe was taken for a terminal")
+	}
+	for _, want := range []string{"search hello", "next"} {
+		if got, err := e.ReadLine("> "); err != nil || got != want {
+			t.Errorf("got %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("at the end of input: got %v, want io.EOF", err)
+	}
+	if out.String() != "> > > " || len(e.History.Entries()) != 0 {
+		t.Errorf("got output %q and history %q, want only the prompts", out.String(), e.History.Entries())
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "history")
+
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"next", "next", " ", "search hello", "prev"} {
+		if err := h.Add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err = LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(h.Entries(), "|"); got != "next|search hello|prev" {
+		t.Errorf("got history %q, want next|search hello|prev", got)
+	}
+
+	h.Max = 2
+	if got := strings.Join(h.Entries(), "|"); got != "search hello|prev" {
+		t.Errorf("got history %q with Max 2, want the newest two", got)
+	}
+}
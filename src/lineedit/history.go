@@ -0,0 +1,109 @@
+package lineedit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHistorySize is the number of entries kept when History.Max is zero
+const DefaultHistorySize = 1000
+
+// History is the list of entered lines, oldest first, optionally persisted to a file
+type History struct {
+	Path    string // file the history is loaded from and appended to; empty keeps it in memory
+	Max     int
+	entries []string
+}
+
+// LoadHistory reads the history file at path. A missing file is an empty history.
+func LoadHistory(path string) (*History, error) {
+	h := &History{Path: path}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return h, fmt.Errorf("error reading history: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return h, fmt.Errorf("error reading history: %v", err)
+	}
+
+	// Rewrite the file once it has grown well past the limit
+	if len(h.entries) > 2*h.max() {
+		h.entries = h.entries[len(h.entries)-h.max():]
+		if err := h.rewrite(); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+func (h *History) max() int {
+	if h.Max > 0 {
+		return h.Max
+	}
+	return DefaultHistorySize
+}
+
+// Entries returns the lines in the history, oldest first
+func (h *History) Entries() []string {
+	if len(h.entries) > h.max() {
+		return h.entries[len(h.entries)-h.max():]
+	}
+	return h.entries
+}
+
+// Add appends a line unless it is blank or repeats the previous one, and saves it
+func (h *History) Add(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.Contains(line, "\n") {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+	if h.Path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.Path), 0700); err != nil {
+		return fmt.Errorf("error saving history: %v", err)
+	}
+	file, err := os.OpenFile(h.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error saving history: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintln(file, line); err != nil {
+		return fmt.Errorf("error saving history: %v", err)
+	}
+	return nil
+}
+
+// rewrite replaces the history file with the entries in memory
+func (h *History) rewrite() error {
+	tmp := h.Path + ".tmp"
+	content := strings.Join(h.entries, "\n") + "\n"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err != nil {
+		return fmt.Errorf("error saving history: %v", err)
+	}
+	if err := os.Rename(tmp, h.Path); err != nil {
+		return fmt.Errorf("error saving history: %v", err)
+	}
+	return nil
+}
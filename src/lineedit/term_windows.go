@@ -0,0 +1,62 @@
+package lineedit
+
+import "syscall"
+
+// Console modes, see https://learn.microsoft.com/windows/console/setconsolemode
+const (
+	enableProcessedInput            = 0x1
+	enableLineInput                 = 0x2
+	enableEchoInput                 = 0x4
+	enableVirtualTerminalInput      = 0x200
+	enableVirtualTerminalProcessing = 0x4
+)
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+func getConsoleMode(fd int) (uint32, error) {
+	var mode uint32
+	err := syscall.GetConsoleMode(syscall.Handle(fd), &mode)
+	return mode, err
+}
+
+func setConsoleMode(fd int, mode uint32) error {
+	if ok, _, err := procSetConsoleMode.Call(uintptr(fd), uintptr(mode)); ok == 0 {
+		return err
+	}
+	return nil
+}
+
+// isTerminal reports whether fd is a console
+func isTerminal(fd int) bool {
+	_, err := getConsoleMode(fd)
+	return err == nil
+}
+
+// makeRaw turns off line input, echo and Ctrl-C handling, has keys read as
+// the escape sequences of a terminal, and lets the console output interpret
+// them. It returns a function restoring the previous modes.
+func makeRaw(fd int) (func(), error) {
+	old, err := getConsoleMode(fd)
+	if err != nil {
+		return nil, err
+	}
+	raw := old&^(enableProcessedInput|enableLineInput|enableEchoInput) | enableVirtualTerminalInput
+	if err := setConsoleMode(fd, raw); err != nil {
+		return nil, err
+	}
+
+	// Without escape sequence processing the prompt cannot be redrawn, but
+	// typing still works, so a console that lacks it is not an error
+	out := int(syscall.Stdout)
+	oldOut, outErr := getConsoleMode(out)
+	if outErr == nil {
+		setConsoleMode(out, oldOut|enableVirtualTerminalProcessing)
+	}
+
+	return func() {
+		setConsoleMode(fd, old)
+		if outErr == nil {
+			setConsoleMode(out, oldOut)
+		}
+	}, nil
+}
@@ -0,0 +1,427 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Output formats accepted by NewRenderer
+const (
+	OutputBox      = "box"
+	OutputJSON     = "json"
+	OutputNDJSON   = "ndjson"
+	OutputTSV      = "tsv"
+	OutputTemplate = "template="
+)
+
+// TrackRecord is the machine-readable form of a track
+type TrackRecord struct {
+	Index      int      `json:"index"`
+	Name       string   `json:"name"`
+	URI        string   `json:"uri"`
+	Artists    []string `json:"artists"`
+	Album      string   `json:"album"`
+	DurationMs int      `json:"duration_ms"`
+	Type       string   `json:"type"`
+}
+
+// AlbumRecord is the machine-readable form of an album
+type AlbumRecord struct {
+	Index       int      `json:"index"`
+	Name        string   `json:"name"`
+	URI         string   `json:"uri"`
+	ID          string   `json:"id"`
+	Artists     []string `json:"artists"`
+	ReleaseDate string   `json:"release_date"`
+	Type        string   `json:"type"`
+}
+
+// ArtistRecord is the machine-readable form of an artist
+type ArtistRecord struct {
+	Index  int      `json:"index"`
+	Name   string   `json:"name"`
+	URI    string   `json:"uri"`
+	ID     string   `json:"id"`
+	Genres []string `json:"genres"`
+	Type   string   `json:"type"`
+}
+
+// ShowRecord is the machine-readable form of a show
+type ShowRecord struct {
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	URI       string `json:"uri"`
+	ID        string `json:"id"`
+	Publisher string `json:"publisher"`
+	Type      string `json:"type"`
+}
+
+// EpisodeRecord is the machine-readable form of an episode
+type EpisodeRecord struct {
+	Index       int    `json:"index"`
+	Name        string `json:"name"`
+	URI         string `json:"uri"`
+	ID          string `json:"id"`
+	ReleaseDate string `json:"release_date"`
+	DurationMs  int    `json:"duration_ms"`
+	Type        string `json:"type"`
+}
+
+// PlaylistRecord is the machine-readable form of a playlist
+type PlaylistRecord struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	URI    string `json:"uri"`
+	ID     string `json:"id"`
+	Owner  string `json:"owner"`
+	Tracks int    `json:"tracks"`
+	Type   string `json:"type"`
+}
+
+// DeviceRecord is the machine-readable form of a device
+type DeviceRecord struct {
+	Index         int    `json:"index"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	IsActive      bool   `json:"is_active"`
+	IsRestricted  bool   `json:"is_restricted"`
+	VolumePercent int    `json:"volume_percent"`
+}
+
+// PlaybackRecord is the machine-readable form of the player state
+type PlaybackRecord struct {
+	IsPlaying     bool         `json:"is_playing"`
+	ProgressMs    int          `json:"progress_ms"`
+	Track         *TrackRecord `json:"track"`
+	Device        string       `json:"device"`
+	DeviceType    string       `json:"device_type"`
+	VolumePercent int          `json:"volume_percent"`
+	Shuffle       bool         `json:"shuffle"`
+	Repeat        string       `json:"repeat"`
+	Context       string       `json:"context"`
+}
+
+// ShuffleRecord is the machine-readable form of the shuffle state
+type ShuffleRecord struct {
+	Shuffle bool `json:"shuffle"`
+}
+
+// RepeatRecord is the machine-readable form of a repeat mode
+type RepeatRecord struct {
+	Repeat string `json:"repeat"`
+}
+
+func artistNames(artists []Artist) []string {
+	names := make([]string, len(artists))
+	for i, artist := range artists {
+		names[i] = artist.Name
+	}
+	return names
+}
+
+func newTrackRecord(index int, track Track) TrackRecord {
+	record := TrackRecord{
+		Index:      index,
+		Name:       track.Name,
+		URI:        track.URI,
+		Artists:    artistNames(track.Artists),
+		Album:      track.Album.Name,
+		DurationMs: track.Duration,
+		Type:       track.Type,
+	}
+	if record.Type == "" {
+		record.Type = SearchTypeTrack
+	}
+	return record
+}
+
+func newAlbumRecord(index int, album Album) AlbumRecord {
+	return AlbumRecord{
+		Index:       index,
+		Name:        album.Name,
+		URI:         album.URI,
+		ID:          album.ID,
+		Artists:     artistNames(album.Artists),
+		ReleaseDate: album.ReleaseDate,
+		Type:        SearchTypeAlbum,
+	}
+}
+
+func newArtistRecord(index int, artist Artist) ArtistRecord {
+	genres := artist.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+	return ArtistRecord{Index: index, Name: artist.Name, URI: artist.URI, ID: artist.ID, Genres: genres, Type: SearchTypeArtist}
+}
+
+func newShowRecord(index int, show Show) ShowRecord {
+	return ShowRecord{Index: index, Name: show.Name, URI: show.URI, ID: show.ID, Publisher: show.Publisher, Type: SearchTypeShow}
+}
+
+func newEpisodeRecord(index int, episode Episode) EpisodeRecord {
+	return EpisodeRecord{
+		Index:       index,
+		Name:        episode.Name,
+		URI:         episode.URI,
+		ID:          episode.ID,
+		ReleaseDate: episode.ReleaseDate,
+		DurationMs:  episode.Duration,
+		Type:        SearchTypeEpisode,
+	}
+}
+
+func newPlaylistRecord(index int, playlist Playlist) PlaylistRecord {
+	return PlaylistRecord{
+		Index:  index,
+		Name:   playlist.Name,
+		URI:    playlist.URI,
+		ID:     playlist.ID,
+		Owner:  playlist.Owner.DisplayName,
+		Tracks: playlist.Tracks.Total,
+		Type:   SearchTypePlaylist,
+	}
+}
+
+func newDeviceRecord(index int, device Device) DeviceRecord {
+	return DeviceRecord{
+		Index:         index,
+		ID:            device.ID,
+		Name:          device.Name,
+		Type:          device.Type,
+		IsActive:      device.IsActive,
+		IsRestricted:  device.IsRestricted,
+		VolumePercent: device.VolumePercent,
+	}
+}
+
+func newPlaybackRecord(state *PlaybackState) PlaybackRecord {
+	record := PlaybackRecord{
+		IsPlaying:     state.IsPlaying,
+		ProgressMs:    state.ProgressMs,
+		Device:        state.Device.Name,
+		DeviceType:    state.Device.Type,
+		VolumePercent: state.Device.VolumePercent,
+		Shuffle:       state.ShuffleState,
+		Repeat:        state.RepeatState,
+	}
+	if state.Item != nil {
+		track := newTrackRecord(0, *state.Item)
+		record.Track = &track
+	}
+	if state.Context != nil {
+		record.Context = state.Context.URI
+	}
+	return record
+}
+
+// tsvRow returns the tab-separated columns of a record, in the order of its JSON fields
+func tsvRow(record interface{}) []string {
+	itoa := strconv.Itoa
+	btoa := strconv.FormatBool
+	switch r := record.(type) {
+	case TrackRecord:
+		return []string{itoa(r.Index), r.Name, r.URI, strings.Join(r.Artists, ", "), r.Album, itoa(r.DurationMs), r.Type}
+	case AlbumRecord:
+		return []string{itoa(r.Index), r.Name, r.URI, r.ID, strings.Join(r.Artists, ", "), r.ReleaseDate, r.Type}
+	case ArtistRecord:
+		return []string{itoa(r.Index), r.Name, r.URI, r.ID, strings.Join(r.Genres, ", "), r.Type}
+	case PlaylistRecord:
+		return []string{itoa(r.Index), r.Name, r.URI, r.ID, r.Owner, itoa(r.Tracks), r.Type}
+	case ShowRecord:
+		return []string{itoa(r.Index), r.Name, r.URI, r.ID, r.Publisher, r.Type}
+	case EpisodeRecord:
+		return []string{itoa(r.Index), r.Name, r.URI, r.ID, r.ReleaseDate, itoa(r.DurationMs), r.Type}
+	case DeviceRecord:
+		return []string{itoa(r.Index), r.ID, r.Name, r.Type, btoa(r.IsActive), btoa(r.IsRestricted), itoa(r.VolumePercent)}
+	case PlaybackRecord:
+		// The track is flattened into its columns, which are empty when nothing is loaded
+		track := TrackRecord{}
+		if r.Track != nil {
+			track = *r.Track
+		}
+		return []string{btoa(r.IsPlaying), itoa(r.ProgressMs), track.Name, track.URI, strings.Join(track.Artists, ", "), track.Album, itoa(track.DurationMs),
+			r.Device, r.DeviceType, itoa(r.VolumePercent), btoa(r.Shuffle), r.Repeat, r.Context}
+	case ShuffleRecord:
+		return []string{btoa(r.Shuffle)}
+	case RepeatRecord:
+		return []string{r.Repeat}
+	}
+	return nil
+}
+
+// FormatRenderer writes results as JSON, NDJSON, TSV or a Go template for scripts.
+// Confirmations are not printed; errors go to a separate writer.
+type FormatRenderer struct {
+	format string
+	tmpl   *template.Template
+	w      io.Writer
+	errw   io.Writer
+}
+
+// NewRenderer returns the renderer for an output format: box (default), json,
+// ndjson, tsv or template=<Go template>. Data is written to w and errors to errw.
+func NewRenderer(output string, w, errw io.Writer) (Renderer, error) {
+	switch {
+	case output == "" || output == OutputBox:
+		return NewBoxRenderer(w), nil
+	case output == OutputJSON || output == OutputNDJSON || output == OutputTSV:
+		return &FormatRenderer{format: output, w: w, errw: errw}, nil
+	case strings.HasPrefix(output, OutputTemplate):
+		tmpl, err := template.New("output").Funcs(template.FuncMap{"join": strings.Join}).Parse(strings.TrimPrefix(output, OutputTemplate))
+		if err != nil {
+			return nil, fmt.Errorf("invalid output template: %v", err)
+		}
+		return &FormatRenderer{format: OutputTemplate, tmpl: tmpl, w: w, errw: errw}, nil
+	}
+	return nil, fmt.Errorf("invalid output format: %s. Valid formats are: box, json, ndjson, tsv, template=<template>", output)
+}
+
+// list writes a list of records
+func (r *FormatRenderer) list(records []interface{}) {
+	if r.format == OutputJSON {
+		r.writeJSON(records, "  ")
+		return
+	}
+	for _, record := range records {
+		r.item(record)
+	}
+}
+
+// single writes one record, or nothing but JSON null when record is nil
+func (r *FormatRenderer) single(record interface{}) {
+	if record == nil {
+		if r.format == OutputJSON {
+			fmt.Fprintln(r.w, "null")
+		}
+		return
+	}
+	if r.format == OutputJSON {
+		r.writeJSON(record, "  ")
+		return
+	}
+	r.item(record)
+}
+
+// item writes a record as one line of NDJSON or TSV, or one template execution
+func (r *FormatRenderer) item(record interface{}) {
+	switch r.format {
+	case OutputNDJSON:
+		r.writeJSON(record, "")
+	case OutputTSV:
+		columns := tsvRow(record)
+		for i, column := range columns {
+			columns[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(column)
+		}
+		fmt.Fprintln(r.w, strings.Join(columns, "\t"))
+	case OutputTemplate:
+		if err := r.tmpl.Execute(r.w, record); err != nil {
+			fmt.Fprintln(r.errw, "Error: executing output template:", err)
+			return
+		}
+		fmt.Fprintln(r.w)
+	}
+}
+
+func (r *FormatRenderer) writeJSON(v interface{}, indent string) {
+	encoder := json.NewEncoder(r.w)
+	encoder.SetIndent("", indent)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintln(r.errw, "Error: encoding output:", err)
+	}
+}
+
+func (r *FormatRenderer) SearchResults(results SearchResults) {
+	// Records are numbered across groups like SearchResults.Items
+	records := []interface{}{}
+	next := func() int { return len(records) + 1 }
+	for _, track := range results.Tracks {
+		records = append(records, newTrackRecord(next(), track))
+	}
+	for _, album := range results.Albums {
+		records = append(records, newAlbumRecord(next(), album))
+	}
+	for _, artist := range results.Artists {
+		records = append(records, newArtistRecord(next(), artist))
+	}
+	for _, playlist := range results.Playlists {
+		records = append(records, newPlaylistRecord(next(), playlist))
+	}
+	for _, show := range results.Shows {
+		records = append(records, newShowRecord(next(), show))
+	}
+	for _, episode := range results.Episodes {
+		records = append(records, newEpisodeRecord(next(), episode))
+	}
+	r.list(records)
+}
+
+func (r *FormatRenderer) NewReleases(releases NewReleases) {
+	records := []interface{}{}
+	for i, album := range releases.Albums {
+		records = append(records, newAlbumRecord(i+1, album))
+	}
+	r.list(records)
+}
+
+func (r *FormatRenderer) Playlists(playlists Playlists) {
+	records := []interface{}{}
+	for i, playlist := range playlists.Items {
+		records = append(records, newPlaylistRecord(i+1, playlist))
+	}
+	r.list(records)
+}
+
+func (r *FormatRenderer) Devices(devices []Device) {
+	records := []interface{}{}
+	for i, device := range devices {
+		records = append(records, newDeviceRecord(i+1, device))
+	}
+	r.list(records)
+}
+
+func (r *FormatRenderer) PlaybackState(state *PlaybackState) {
+	if state == nil {
+		r.single(nil)
+		return
+	}
+	r.single(newPlaybackRecord(state))
+}
+
+func (r *FormatRenderer) Queue(queue *Queue) {
+	// The playing item has index 0 and the items after it are numbered from 1
+	records := []interface{}{}
+	if queue != nil {
+		if queue.CurrentlyPlaying != nil {
+			records = append(records, newTrackRecord(0, *queue.CurrentlyPlaying))
+		}
+		for i, track := range queue.Queue {
+			records = append(records, newTrackRecord(i+1, track))
+		}
+	}
+	r.list(records)
+}
+
+func (r *FormatRenderer) Shuffle(on bool) {
+	r.single(ShuffleRecord{Shuffle: on})
+}
+
+func (r *FormatRenderer) RepeatMode(mode string) {
+	r.single(RepeatRecord{Repeat: mode})
+}
+
+func (r *FormatRenderer) RepeatModeSet(mode string) {
+	r.single(RepeatRecord{Repeat: mode})
+}
+
+func (r *FormatRenderer) Message(text string) {}
+
+func (r *FormatRenderer) Error(err error) {
+	fmt.Fprintln(r.errw, "Error:", err)
+}
@@ -0,0 +1,52 @@
+package spotify_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	spotify "spotify-cli/src"
+)
+
+func TestRendererOutputFormats(t *testing.T) {
+	results := spotify.SearchResults{Tracks: []spotify.Track{
+		{Name: "Hello\tWorld", URI: "spotify:track:1", Artists: []spotify.Artist{{Name: "A"}, {Name: "B"}}, Duration: 1000},
+		{Name: "Finale", URI: "spotify:track:2", Artists: []spotify.Artist{{Name: "C"}}, Duration: 2000},
+	}}
+	results.Tracks[0].Album.Name = "First"
+	results.Tracks[1].Album.Name = "Second"
+
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"ndjson", `{"index":1,"name":"Hello\tWorld","uri":"spotify:track:1","artists":["A","B"],"album":"First","duration_ms":1000,"type":"track"}` + "\n" +
+			`{"index":2,"name":"Finale","uri":"spotify:track:2","artists":["C"],"album":"Second","duration_ms":2000,"type":"track"}` + "\n"},
+		{"tsv", "1\tHello World\tspotify:track:1\tA, B\tFirst\t1000\ttrack\n2\tFinale\tspotify:track:2\tC\tSecond\t2000\ttrack\n"},
+		{"template={{.URI}} {{join .Artists \"+\"}}", "spotify:track:1 A+B\nspotify:track:2 C\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		renderer, err := spotify.NewRenderer(tt.output, &out, &out)
+		if err != nil {
+			t.Fatalf("NewRenderer(%q): %v", tt.output, err)
+		}
+		renderer.SearchResults(results)
+		if out.String() != tt.want {
+			t.Errorf("%s output = %q, want %q", tt.output, out.String(), tt.want)
+		}
+	}
+}
+
+func TestRendererNothingPlaying(t *testing.T) {
+	var out bytes.Buffer
+	renderer, _ := spotify.NewRenderer("json", &out, &out)
+	renderer.PlaybackState(nil)
+	if strings.TrimSpace(out.String()) != "null" {
+		t.Errorf("got %q, want null", out.String())
+	}
+
+	if _, err := spotify.NewRenderer("yaml", &out, &out); err == nil {
+		t.Error("NewRenderer(yaml) succeeded, want error")
+	}
+}
@@ -0,0 +1,109 @@
+package spotify
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Queue is the item playing now and the items that play after it, starting
+// with the ones added to the queue
+type Queue struct {
+	CurrentlyPlaying *Track  `json:"currently_playing"`
+	Queue            []Track `json:"queue"`
+}
+
+// GetQueue returns the user's queue. Episodes are returned as tracks without
+// artists and album.
+func (c *SpotifyClient) GetQueue() (*Queue, error) {
+	var queue Queue
+
+	if _, err := c.do("GET", "/me/player/queue", nil, &queue); err != nil {
+		if IsStatus(err, http.StatusNotFound) {
+			return nil, ErrNoActiveDevice
+		}
+		return nil, fmt.Errorf("error getting queue: %w", err)
+	}
+	return &queue, nil
+}
+
+// AddToQueue adds a track or episode URI to the end of the queue, after the
+// items added before it and before the rest of the playing album or playlist
+func (c *SpotifyClient) AddToQueue(uri string) error {
+	if _, err := c.do("POST", "/me/player/queue?uri="+url.QueryEscape(uri), nil, nil); err != nil {
+		if IsStatus(err, http.StatusNotFound) {
+			return ErrNoActiveDevice
+		}
+		return fmt.Errorf("error adding %s to queue: %w", uri, err)
+	}
+	return nil
+}
+
+// Enqueue adds a track or episode, or every track of an album or playlist, to
+// the queue and returns the number of items added. Artists and shows are not
+// queued, as there is no telling which of their items are meant.
+func (c *SpotifyClient) Enqueue(uri SpotifyURI) (int, error) {
+	var uris []string
+	switch uri.Type {
+	case SearchTypeTrack, SearchTypeEpisode:
+		uris = []string{uri.String()}
+	case SearchTypeAlbum, SearchTypePlaylist:
+		tracks, err := c.contextTracks(uri)
+		if err != nil {
+			return 0, err
+		}
+		for _, track := range tracks {
+			uris = append(uris, track.URI)
+		}
+	default:
+		return 0, fmt.Errorf("%ss cannot be queued, only tracks, episodes, albums and playlists", uri.Type)
+	}
+
+	for i, uri := range uris {
+		if err := c.AddToQueue(uri); err != nil {
+			return i, err
+		}
+	}
+	return len(uris), nil
+}
+
+// contextTracks returns every track of an album or playlist. Local files and
+// removed tracks cannot be played by URI and are left out.
+func (c *SpotifyClient) contextTracks(uri SpotifyURI) ([]Track, error) {
+	var tracks []Track
+	reqPath := "/" + uri.Type + "s/" + uri.ID + "/tracks?limit=50"
+	for reqPath != "" {
+		// Album pages list tracks; playlist pages wrap them in a track field
+		var page struct {
+			Items []struct {
+				Track
+				PlaylistTrack *Track `json:"track"`
+			} `json:"items"`
+			Next string `json:"next"`
+		}
+		if _, err := c.do("GET", reqPath, nil, &page); err != nil {
+			return nil, fmt.Errorf("error getting tracks: %w", err)
+		}
+
+		for _, item := range page.Items {
+			track := item.Track
+			if item.PlaylistTrack != nil {
+				track = *item.PlaylistTrack
+			}
+			if track.URI != "" && !strings.HasPrefix(track.URI, "spotify:local:") {
+				tracks = append(tracks, track)
+			}
+		}
+
+		reqPath = ""
+		if page.Next != "" {
+			next, err := c.apiPath(page.Next)
+			if err != nil {
+				return nil, err
+			}
+			reqPath = next
+		}
+	}
+	return tracks, nil
+}
@@ -0,0 +1,128 @@
+package spotify
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// TrackMatch is a track scored against the wanted title and artist
+type TrackMatch struct {
+	Track Track
+	Score int
+}
+
+// Scores of the parts of a match
+const (
+	scoreExactTitle  = 100 // the title is the query
+	scoreBaseTitle   = 90  // the title without "(Remastered)" or " - Live" is the query
+	scoreTitlePrefix = 50
+	scoreInTitle     = 30
+	scoreArtist      = 60 // an artist is the wanted one
+	scoreInArtist    = 30
+	scoreWrongArtist = -40
+
+	// closeMargin is how far below the best a match may score and still be a
+	// plausible choice
+	closeMargin = 15
+)
+
+// RankTracks scores tracks against the wanted title and optional artist and
+// returns them best first. Exact title and artist matches count most, and
+// popularity breaks ties. Without an artist, a query such as "one metallica"
+// also matches the title and artist together.
+func RankTracks(tracks []Track, title, artist string) []TrackMatch {
+	title, artist = normalize(title), normalize(artist)
+
+	matches := make([]TrackMatch, len(tracks))
+	for i, track := range tracks {
+		matches[i] = TrackMatch{Track: track, Score: scoreTrack(track, title, artist) + track.Popularity/5}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+// scoreTrack scores a track against a normalized title and artist
+func scoreTrack(track Track, title, artist string) int {
+	name, base := normalize(track.Name), normalize(baseTitle(track.Name))
+
+	if artist == "" {
+		// The query may name the artist too, before or after the title
+		for _, a := range track.Artists {
+			a := normalize(a.Name)
+			for _, t := range []string{name, base} {
+				if title == t+" "+a || title == a+" "+t {
+					return scoreExactTitle + scoreArtist
+				}
+			}
+		}
+	}
+
+	score := 0
+	switch {
+	case name == title:
+		score = scoreExactTitle
+	case base == title:
+		score = scoreBaseTitle
+	case strings.HasPrefix(name, title):
+		score = scoreTitlePrefix
+	case strings.Contains(name, title):
+		score = scoreInTitle
+	}
+
+	if artist != "" {
+		artistScore := scoreWrongArtist
+		for _, a := range track.Artists {
+			a := normalize(a.Name)
+			switch {
+			case a == artist:
+				artistScore = max(artistScore, scoreArtist)
+			case strings.Contains(a, artist) || strings.Contains(artist, a):
+				artistScore = max(artistScore, scoreInArtist)
+			}
+		}
+		score += artistScore
+	}
+	return score
+}
+
+// CloseMatches returns the ranked matches that score close to the best one,
+// leaving out other releases of a song already included. More than one means
+// the query is ambiguous.
+func CloseMatches(matches []TrackMatch) []TrackMatch {
+	var candidates []TrackMatch
+	seen := map[string]bool{}
+	for _, match := range matches {
+		if match.Score < matches[0].Score-closeMargin {
+			break
+		}
+		song := normalize(baseTitle(match.Track.Name))
+		if len(match.Track.Artists) > 0 {
+			song += "\x00" + normalize(match.Track.Artists[0].Name)
+		}
+		if !seen[song] {
+			seen[song] = true
+			candidates = append(candidates, match)
+		}
+	}
+	return candidates
+}
+
+// baseTitle returns a title without a trailing version such as "(Live)",
+// "[Remix]" or " - Remastered 2011"
+func baseTitle(title string) string {
+	if i := strings.IndexAny(title, "(["); i > 0 {
+		title = title[:i]
+	}
+	if i := strings.Index(title, " - "); i > 0 {
+		title = title[:i]
+	}
+	return title
+}
+
+// normalize lowercases s and reduces punctuation and runs of spaces to single spaces
+func normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,344 @@
+package spotify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Renderer presents the data returned by the API methods
+type Renderer interface {
+	SearchResults(results SearchResults)
+	NewReleases(releases NewReleases)
+	Playlists(playlists Playlists)
+	Devices(devices []Device)
+	// PlaybackState renders the player state; nil means nothing is playing
+	PlaybackState(state *PlaybackState)
+	// Queue renders the playing item and the items after it
+	Queue(queue *Queue)
+	// Shuffle renders whether shuffle is on
+	Shuffle(on bool)
+	// RepeatMode renders the current repeat mode
+	RepeatMode(mode string)
+	// RepeatModeSet renders a repeat mode that was just set
+	RepeatModeSet(mode string)
+	// Message renders a confirmation such as "Skipped to next track"
+	Message(text string)
+	// Error renders a failed command
+	Error(err error)
+}
+
+// BoxRenderer draws results as colored boxes for interactive terminals
+type BoxRenderer struct {
+	w io.Writer
+}
+
+// NewBoxRenderer returns a BoxRenderer writing to w
+func NewBoxRenderer(w io.Writer) *BoxRenderer {
+	return &BoxRenderer{w: w}
+}
+
+// searchEntry is one numbered search result with its detail lines
+type searchEntry struct {
+	name    string
+	details [][2]string // label and value
+}
+
+// searchGroups returns the non-empty groups of the results with their titles, in the order of SearchResults.Items
+func searchGroups(results SearchResults) (titles []string, groups [][]searchEntry) {
+	add := func(title string, entries []searchEntry) {
+		if len(entries) > 0 {
+			titles = append(titles, title)
+			groups = append(groups, entries)
+		}
+	}
+
+	var entries []searchEntry
+	for _, track := range results.Tracks {
+		entries = append(entries, searchEntry{track.Name, [][2]string{{"Artist", formatArtists(track.Artists)}, {"Album", track.Album.Name}}})
+	}
+	add("Tracks", entries)
+
+	entries = nil
+	for _, album := range results.Albums {
+		entries = append(entries, searchEntry{album.Name, [][2]string{{"Artist", formatArtists(album.Artists)}, {"Released", album.ReleaseDate}}})
+	}
+	add("Albums", entries)
+
+	entries = nil
+	for _, artist := range results.Artists {
+		var details [][2]string
+		if len(artist.Genres) > 0 {
+			details = append(details, [2]string{"Genres", strings.Join(artist.Genres, ", ")})
+		}
+		entries = append(entries, searchEntry{artist.Name, details})
+	}
+	add("Artists", entries)
+
+	entries = nil
+	for _, playlist := range results.Playlists {
+		entries = append(entries, searchEntry{playlist.Name, [][2]string{{"Owner", playlist.Owner.DisplayName}, {"Tracks", fmt.Sprint(playlist.Tracks.Total)}}})
+	}
+	add("Playlists", entries)
+
+	entries = nil
+	for _, show := range results.Shows {
+		entries = append(entries, searchEntry{show.Name, [][2]string{{"Publisher", show.Publisher}}})
+	}
+	add("Shows", entries)
+
+	entries = nil
+	for _, episode := range results.Episodes {
+		entries = append(entries, searchEntry{episode.Name, [][2]string{{"Released", episode.ReleaseDate}, {"Duration", FormatTime(episode.Duration)}}})
+	}
+	add("Episodes", entries)
+
+	return titles, groups
+}
+
+func (r *BoxRenderer) SearchResults(results SearchResults) {
+	fmt.Fprintln(r.w, "\n\033[1;36m╔══════════════════════════════════════════════════════════════════════════╗\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m║\033[0m \033[1;33mSearch Results:\033[0m                                                        \033[1;36m║\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+
+	// Results are numbered across groups; group titles are only shown for more than one group
+	titles, groups := searchGroups(results)
+	n := 0
+	for g, entries := range groups {
+		if len(groups) > 1 {
+			if g > 0 {
+				fmt.Fprintln(r.w, "\033[1;36m╟──────────────────────────────────────────────────────────────────────────╢\033[0m")
+			}
+			fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;35m%-72s\033[0m \033[1;36m║\033[0m\n", titles[g])
+		}
+		for i, entry := range entries {
+			n++
+			fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;32m%2d.\033[0m %-70s \033[1;36m║\033[0m\n", n, truncateString(entry.name, 70))
+			for _, detail := range entry.details {
+				label := detail[0] + ":"
+				width := 73 - len(label)
+				fmt.Fprintf(r.w, "\033[1;36m║\033[0m     \033[1;90m%s\033[0m %-*s \033[1;36m║\033[0m\n", label, width, truncateString(detail[1], width))
+			}
+			if i < len(entries)-1 {
+				fmt.Fprintln(r.w, "\033[1;36m║\033[0m                                                                          \033[1;36m║\033[0m")
+			}
+		}
+	}
+
+	// Show where the page lies when there is more than one
+	if results.Next != "" || results.Previous != "" {
+		last := results.Offset
+		for _, entries := range groups {
+			last = max(last, results.Offset+len(entries))
+		}
+		page := fmt.Sprintf("Results %d-%d of %d", results.Offset+1, last, results.Total)
+		fmt.Fprintln(r.w, "\033[1;36m╟──────────────────────────────────────────────────────────────────────────╢\033[0m")
+		fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;90m%-72s\033[0m \033[1;36m║\033[0m\n", page)
+	}
+
+	fmt.Fprintln(r.w, "\033[1;36m╚══════════════════════════════════════════════════════════════════════════╝\033[0m")
+}
+
+func (r *BoxRenderer) NewReleases(releases NewReleases) {
+	fmt.Fprintln(r.w, "\n\033[1;36m╔══════════════════════════════════════════════════════════════════════════╗\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m║\033[0m \033[1;33mNew Releases:\033[0m                                                          \033[1;36m║\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+
+	for i, album := range releases.Albums {
+		fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;32m%2d.\033[0m %-70s \033[1;36m║\033[0m\n", i+1, truncateString(album.Name, 70))
+		fmt.Fprintf(r.w, "\033[1;36m║\033[0m     \033[1;90mArtist:\033[0m %-66s \033[1;36m║\033[0m\n", truncateString(formatArtists(album.Artists), 66))
+		if i < len(releases.Albums)-1 {
+			fmt.Fprintln(r.w, "\033[1;36m║\033[0m                                                                          \033[1;36m║\033[0m")
+		}
+	}
+
+	fmt.Fprintln(r.w, "\033[1;36m╚══════════════════════════════════════════════════════════════════════════╝\033[0m")
+}
+
+func (r *BoxRenderer) Playlists(playlists Playlists) {
+	fmt.Fprintln(r.w, "\033[1;36m╔══════════════════════════════════════════════════════════════════════════╗\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m║ \033[1;33mYour Playlists                                                          \033[1;36m║\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+
+	for i, playlist := range playlists.Items {
+		fmt.Fprintf(r.w, "\033[1;36m║ \033[1;32m%2d. \033[1;37m%-65s \033[1;36m║\033[0m\n", i+1, truncateString(playlist.Name, 65))
+	}
+
+	fmt.Fprintln(r.w, "\033[1;36m╚══════════════════════════════════════════════════════════════════════════╝\033[0m")
+}
+
+func (r *BoxRenderer) Devices(devices []Device) {
+	fmt.Fprintln(r.w, "\033[1;36m╔══════════════════════════════════════════════════════════════════════════╗\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m║ \033[1;33mYour Devices                                                            \033[1;36m║\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+
+	for i, device := range devices {
+		name := fmt.Sprintf("%s (%s)", device.Name, device.Type)
+		status := []string{fmt.Sprintf("volume %d%%", device.VolumePercent)}
+		if device.IsActive {
+			status = append([]string{"active"}, status...)
+		}
+		if device.IsRestricted {
+			status = append(status, "restricted")
+		}
+		name += " - " + strings.Join(status, ", ")
+		fmt.Fprintf(r.w, "\033[1;36m║ \033[1;32m%2d. \033[1;37m%-65s \033[1;36m║\033[0m\n", i+1, truncateString(name, 65))
+	}
+
+	fmt.Fprintln(r.w, "\033[1;36m╚══════════════════════════════════════════════════════════════════════════╝\033[0m")
+}
+
+func (r *BoxRenderer) PlaybackState(state *PlaybackState) {
+	if state == nil || state.Item == nil {
+		fmt.Fprintln(r.w, "\n\033[1;31m╔══════════════════════════════════════════════╗")
+		fmt.Fprintln(r.w, "║  No track currently playing                  ║")
+		fmt.Fprintln(r.w, "╚══════════════════════════════════════════════╝\033[0m")
+		return
+	}
+
+	item := state.Item
+	duration := item.Duration
+
+	// Format status and progress information
+	status := "\033[1;32m▶ Playing\033[0m"
+	if !state.IsPlaying {
+		status = "\033[1;31m⏸ Paused\033[0m"
+	}
+
+	// Calculate progress bar (30 chars wide)
+	progressPercent := 0.0
+	if duration > 0 {
+		progressPercent = float64(state.ProgressMs) / float64(duration)
+	}
+	progressBarWidth := 30
+	progressChars := int(progressPercent * float64(progressBarWidth))
+
+	progressBar := "["
+	for i := 0; i < progressBarWidth; i++ {
+		if i < progressChars {
+			progressBar += "█"
+		} else {
+			progressBar += "░"
+		}
+	}
+	progressBar += "]"
+
+	// Format time as MM:SS
+	progressTime := FormatTime(state.ProgressMs)
+	totalTime := FormatTime(duration)
+
+	// Format shuffle and repeat state
+	shuffleState := "\033[1;31mOff\033[0m (In order)"
+	if state.ShuffleState {
+		shuffleState = "\033[1;32mOn\033[0m (Random order)"
+	}
+
+	// Format repeat state with color and description
+	var repeatStateDisplay string
+	switch state.RepeatState {
+	case "off":
+		repeatStateDisplay = "\033[1;31mOff\033[0m (No repeat)"
+	case "track":
+		repeatStateDisplay = "\033[1;32mTrack\033[0m (Repeat current song)"
+	case "context":
+		repeatStateDisplay = "\033[1;32mContext\033[0m (Repeat playlist/album)"
+	default:
+		repeatStateDisplay = state.RepeatState
+	}
+
+	// Create a visually appealing display
+	fmt.Fprintln(r.w, "\n\033[1;36m╔══════════════════════════════════════════════════════════════════════════╗\033[0m")
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m %-74s \033[1;36m║\033[0m\n", status)
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mTrack:\033[0m %-68s \033[1;36m║\033[0m\n", truncateString(item.Name, 68))
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mArtist:\033[0m %-67s \033[1;36m║\033[0m\n", truncateString(formatArtists(item.Artists), 67))
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mAlbum:\033[0m %-68s \033[1;36m║\033[0m\n", truncateString(item.Album.Name, 68))
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m %-74s \033[1;36m║\033[0m\n", progressBar)
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m %-74s \033[1;36m║\033[0m\n", fmt.Sprintf("%s / %s", progressTime, totalTime))
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mDevice:\033[0m %-67s \033[1;36m║\033[0m\n", fmt.Sprintf("%s (%s)", state.Device.Name, state.Device.Type))
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mVolume:\033[0m %-67s \033[1;36m║\033[0m\n", fmt.Sprintf("%d%%", state.Device.VolumePercent))
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mShuffle:\033[0m %-66s \033[1;36m║\033[0m\n", shuffleState)
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mRepeat:\033[0m %-67s \033[1;36m║\033[0m\n", repeatStateDisplay)
+	fmt.Fprintln(r.w, "\033[1;36m╚══════════════════════════════════════════════════════════════════════════╝\033[0m")
+}
+
+func (r *BoxRenderer) Queue(queue *Queue) {
+	if queue == nil || queue.CurrentlyPlaying == nil {
+		r.PlaybackState(nil)
+		return
+	}
+
+	item := queue.CurrentlyPlaying
+	fmt.Fprintln(r.w, "\n\033[1;36m╔══════════════════════════════════════════════════════════════════════════╗\033[0m")
+	fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mNow:\033[0m %-67s \033[1;36m║\033[0m\n", truncateString(item.Name, 67))
+	if len(item.Artists) > 0 {
+		fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;33mArtist:\033[0m %-64s \033[1;36m║\033[0m\n", truncateString(formatArtists(item.Artists), 64))
+	}
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+	fmt.Fprintln(r.w, "\033[1;36m║\033[0m \033[1;33mUp Next:\033[0m                                                                 \033[1;36m║\033[0m")
+
+	if len(queue.Queue) == 0 {
+		fmt.Fprintf(r.w, "\033[1;36m║\033[0m %-72s \033[1;36m║\033[0m\n", "Nothing queued")
+	}
+	for i, track := range queue.Queue {
+		name := track.Name
+		if len(track.Artists) > 0 {
+			name += " - " + formatArtists(track.Artists)
+		}
+		fmt.Fprintf(r.w, "\033[1;36m║\033[0m \033[1;32m%2d.\033[0m %-68s \033[1;36m║\033[0m\n", i+1, truncateString(name, 68))
+	}
+
+	fmt.Fprintln(r.w, "\033[1;36m╚══════════════════════════════════════════════════════════════════════════╝\033[0m")
+}
+
+func (r *BoxRenderer) Shuffle(on bool) {
+	if on {
+		fmt.Fprintln(r.w, "\n\033[1;33mShuffle:\033[0m \033[1;32mOn\033[0m (Random order)")
+	} else {
+		fmt.Fprintln(r.w, "\n\033[1;33mShuffle:\033[0m \033[1;31mOff\033[0m (In order)")
+	}
+}
+
+func (r *BoxRenderer) RepeatMode(mode string) {
+	r.repeatModeBox("REPEAT MODE STATUS", mode)
+}
+
+func (r *BoxRenderer) RepeatModeSet(mode string) {
+	r.repeatModeBox("REPEAT MODE SET   ", mode)
+}
+
+// repeatModeBox displays a repeat mode with a clear text description
+func (r *BoxRenderer) repeatModeBox(title, mode string) {
+	fmt.Fprintln(r.w, "\n\033[1;36m╔══════════════════════════════════════════════════════════════╗\033[0m")
+	fmt.Fprintf(r.w, "\033[1;36m║                      %s                       ║\033[0m\n", title)
+	fmt.Fprintln(r.w, "\033[1;36m╠══════════════════════════════════════════════════════════════╣\033[0m")
+
+	switch mode {
+	case "off":
+		fmt.Fprintln(r.w, "\033[1;36m║\033[0m  Current mode: \033[1;31mOFF\033[0m                                         \033[1;36m║\033[0m")
+		fmt.Fprintln(r.w, "\033[1;36m║\033[0m  Songs will play in sequence without repeating                \033[1;36m║\033[0m")
+	case "track":
+		fmt.Fprintln(r.w, "\033[1;36m║\033[0m  Current mode: \033[1;32mTRACK\033[0m                                       \033[1;36m║\033[0m")
+		fmt.Fprintln(r.w, "\033[1;36m║\033[0m  Current song will repeat continuously                        \033[1;36m║\033[0m")
+	case "context":
+		fmt.Fprintln(r.w, "\033[1;36m║\033[0m  Current mode: \033[1;32mCONTEXT\033[0m                                     \033[1;36m║\033[0m")
+		fmt.Fprintln(r.w, "\033[1;36m║\033[0m  Current playlist or album will repeat after finishing        \033[1;36m║\033[0m")
+	}
+
+	fmt.Fprintln(r.w, "\033[1;36m╚══════════════════════════════════════════════════════════════╝\033[0m")
+}
+
+func (r *BoxRenderer) Message(text string) {
+	fmt.Fprintf(r.w, "\n\033[1;32m%s\033[0m\n", text)
+}
+
+func (r *BoxRenderer) Error(err error) {
+	if errors.Is(err, ErrNoActiveDevice) {
+		fmt.Fprintln(r.w, "\n\033[1;31mNo active device found. Try playing a track first.\033[0m")
+		return
+	}
+	fmt.Fprintln(r.w, "Error:", err)
+}
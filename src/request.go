@@ -0,0 +1,196 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Default base URLs of the Spotify Web API and accounts service
+const (
+	DefaultAPIBaseURL      = "https://api.spotify.com/v1"
+	DefaultAccountsBaseURL = "https://accounts.spotify.com"
+)
+
+// apiURL returns the full Web API URL for a path such as "/me/player"
+func (c *SpotifyClient) apiURL(path string) string {
+	base := c.APIBaseURL
+	if base == "" {
+		base = DefaultAPIBaseURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// apiPath returns the path of a full Web API URL, such as the next link of a
+// paging object, so the request is sent with the client's credentials
+func (c *SpotifyClient) apiPath(link string) (string, error) {
+	base := strings.TrimRight(c.apiURL(""), "/")
+	path, ok := strings.CutPrefix(link, base)
+	if !ok || !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("not a Web API URL: %s", link)
+	}
+	return path, nil
+}
+
+// accountsURL returns the full accounts service URL for a path such as "/api/token"
+func (c *SpotifyClient) accountsURL(path string) string {
+	base := c.AccountsBaseURL
+	if base == "" {
+		base = DefaultAccountsBaseURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// httpClient returns the configured HTTP client or http.DefaultClient
+func (c *SpotifyClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *SpotifyClient) console() io.Writer {
+	if c.Console != nil {
+		return c.Console
+	}
+	return os.Stdout
+}
+
+// ErrNoActiveDevice is returned by player commands when no Spotify device is active
+var ErrNoActiveDevice = errors.New("no active device found. Try playing a track first")
+
+// APIError is returned when the Spotify Web API answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	Reason     string
+	// RetryAfter is the wait requested by the Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("request failed with status %s", e.Status)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return msg
+}
+
+// IsStatus reports whether err is an APIError with the given status code
+func IsStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+// newAPIError builds an APIError from a response, using Spotify's error object when present
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		apiErr.RetryAfter = wait
+	}
+
+	var errorResponse struct {
+		Error struct {
+			Message string `json:"message"`
+			Reason  string `json:"reason"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &errorResponse) == nil {
+		apiErr.Message = errorResponse.Error.Message
+		apiErr.Reason = errorResponse.Error.Reason
+	}
+
+	return apiErr
+}
+
+// do sends an authenticated request to the Web API and decodes a JSON response into out.
+// body, when non-nil, is sent as JSON. On 401 the access token is refreshed once and the
+// request replayed. It returns the response status code, which lets callers tell a
+// 204 No Content apart from a 200 with a body.
+func (c *SpotifyClient) do(method, path string, body interface{}, out interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("error marshaling request: %v", err)
+		}
+	}
+
+	resp, respBody, err := c.sendWithRetry(method, path, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		if err := c.forceRefresh(resp.Request.Header.Get("Authorization")); err != nil {
+			return resp.StatusCode, fmt.Errorf("%w (token refresh failed: %v)", newAPIError(resp, respBody), err)
+		}
+		resp, respBody, err = c.sendWithRetry(method, path, payload)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, newAPIError(resp, respBody)
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("error parsing response: %v", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// sendWithRetry sends a request, retrying rate-limited and temporarily failing attempts
+func (c *SpotifyClient) sendWithRetry(method, path string, payload []byte) (*http.Response, []byte, error) {
+	return c.Retry.withRetry(method, func() (*http.Response, []byte, error) {
+		return c.send(method, path, payload)
+	})
+}
+
+// send performs a single authenticated request and reads the whole response body
+func (c *SpotifyClient) send(method, path string, payload []byte) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.apiURL(path), reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	if err := c.authorize(req); err != nil {
+		return nil, nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading response: %v", err)
+	}
+
+	return resp, respBody, nil
+}
@@ -0,0 +1,138 @@
+package spotify
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults used for zero fields of RetryPolicy
+const (
+	defaultMaxAttempts = 5
+	defaultRetryDelay  = 500 * time.Millisecond
+	defaultMaxDelay    = 30 * time.Second
+	defaultDeadline    = 2 * time.Minute
+)
+
+// sleep is replaced in tests to avoid real waits
+var sleep = time.Sleep
+
+// RetryPolicy controls how rate-limited and temporarily failing requests are retried.
+// Zero fields fall back to the defaults above.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// BaseDelay is the first backoff delay, doubled on every further attempt
+	BaseDelay time.Duration
+	// MaxDelay caps a single backoff delay
+	MaxDelay time.Duration
+	// Deadline caps the total time spent waiting between attempts
+	Deadline time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultMaxDelay
+	}
+	if p.Deadline <= 0 {
+		p.Deadline = defaultDeadline
+	}
+	return p
+}
+
+// retryable reports whether a response status is worth retrying. Rate-limited
+// requests were not processed and are always retried; requests that failed
+// with a server error may have taken effect, so only idempotent ones are.
+func retryable(method string, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
+
+// idempotent reports whether sending a request with method twice has the same
+// effect as sending it once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// backoff returns the jittered exponential delay before the given retry (1-based)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// Pick a random delay between half and all of the exponential delay
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// withRetry calls attempt, which sends a request with method, until it returns a
+// non-retryable response, the policy runs out of attempts, or the next wait would
+// pass the deadline. The last response is returned.
+func (p RetryPolicy) withRetry(method string, attempt func() (*http.Response, []byte, error)) (*http.Response, []byte, error) {
+	p = p.withDefaults()
+	start := time.Now()
+
+	for try := 1; ; try++ {
+		resp, body, err := attempt()
+		if err != nil || !retryable(method, resp.StatusCode) || try >= p.MaxAttempts {
+			return resp, body, err
+		}
+
+		wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			wait = p.backoff(try)
+		}
+
+		if time.Since(start)+wait > p.Deadline {
+			return resp, body, err
+		}
+
+		sleep(wait)
+	}
+}
@@ -0,0 +1,161 @@
+package spotify
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stubSleep records requested waits instead of sleeping
+func stubSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	t.Cleanup(func() { sleep = time.Sleep })
+	return &waits
+}
+
+// get returns an attempt function that fetches url
+func get(url string) func() (*http.Response, []byte, error) {
+	return func() (*http.Response, []byte, error) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, body, err
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	waits := stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	resp, body, err := RetryPolicy{}.withRetry(http.MethodGet, get(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("got %d %q, want 200 \"ok\"", resp.StatusCode, body)
+	}
+	if calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+	if len(*waits) != 2 || (*waits)[0] != 2*time.Second || (*waits)[1] != 2*time.Second {
+		t.Errorf("got waits %v, want [2s 2s]", *waits)
+	}
+}
+
+func TestRetryBacksOffOnServerErrors(t *testing.T) {
+	waits := stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: 250 * time.Millisecond}
+	resp, _, err := policy.withRetry(http.MethodGet, get(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", resp.StatusCode)
+	}
+	if calls != 4 {
+		t.Errorf("got %d calls, want 4", calls)
+	}
+
+	// Each delay is jittered between half and all of 100ms, 200ms, then the 250ms cap
+	limits := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond}
+	if len(*waits) != len(limits) {
+		t.Fatalf("got waits %v, want %d waits", *waits, len(limits))
+	}
+	for i, wait := range *waits {
+		if wait < limits[i]/2 || wait > limits[i] {
+			t.Errorf("wait %d = %s, want between %s and %s", i, wait, limits[i]/2, limits[i])
+		}
+	}
+}
+
+func TestRetryStopsAtDeadline(t *testing.T) {
+	waits := stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	resp, _, err := RetryPolicy{Deadline: 30 * time.Second}.withRetry(http.MethodGet, get(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want 429", resp.StatusCode)
+	}
+	if calls != 1 || len(*waits) != 0 {
+		t.Errorf("got %d calls and waits %v, want 1 call and no waits", calls, *waits)
+	}
+}
+
+func TestRetryIgnoresOtherStatuses(t *testing.T) {
+	stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, _, err := (RetryPolicy{}).withRetry(http.MethodGet, get(server.URL)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"5", 5 * time.Second, true},
+		{" 0 ", 0, true},
+		{"Mon, 01 Jan 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
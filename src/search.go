@@ -1,15 +1,80 @@
 package spotify
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
-// SearchResults holds the search results
+// Search types, in the order the results are grouped
+const (
+	SearchTypeTrack    = "track"
+	SearchTypeAlbum    = "album"
+	SearchTypeArtist   = "artist"
+	SearchTypePlaylist = "playlist"
+	SearchTypeShow     = "show"
+	SearchTypeEpisode  = "episode"
+)
+
+// SearchTypes lists the types Search accepts
+var SearchTypes = []string{SearchTypeTrack, SearchTypeAlbum, SearchTypeArtist, SearchTypePlaylist, SearchTypeShow, SearchTypeEpisode}
+
+// SearchResults holds one page of search results, grouped by type
 type SearchResults struct {
-	Tracks []Track
+	Tracks    []Track
+	Albums    []Album
+	Artists   []Artist
+	Playlists []Playlist
+	Shows     []Show
+	Episodes  []Episode
+
+	// Offset and Limit locate the page, and Total is the number of results of
+	// the largest type. Next and Previous link to the neighbouring pages and are
+	// empty on the last and first page.
+	Offset, Limit, Total int
+	Next, Previous       string
+}
+
+// SearchItem is one entry of the search results
+type SearchItem struct {
+	Type string
+	ID   string
+	Name string
+	URI  string
+}
+
+// Items returns the results of all groups as one list, in the order of SearchTypes.
+// Renderers number the results in this order.
+func (r SearchResults) Items() []SearchItem {
+	var items []SearchItem
+	for _, track := range r.Tracks {
+		items = append(items, SearchItem{Type: SearchTypeTrack, ID: idFromURI(track.URI), Name: track.Name, URI: track.URI})
+	}
+	for _, album := range r.Albums {
+		items = append(items, SearchItem{Type: SearchTypeAlbum, ID: album.ID, Name: album.Name, URI: album.URI})
+	}
+	for _, artist := range r.Artists {
+		items = append(items, SearchItem{Type: SearchTypeArtist, ID: artist.ID, Name: artist.Name, URI: artist.URI})
+	}
+	for _, playlist := range r.Playlists {
+		items = append(items, SearchItem{Type: SearchTypePlaylist, ID: playlist.ID, Name: playlist.Name, URI: playlist.URI})
+	}
+	for _, show := range r.Shows {
+		items = append(items, SearchItem{Type: SearchTypeShow, ID: show.ID, Name: show.Name, URI: show.URI})
+	}
+	for _, episode := range r.Episodes {
+		items = append(items, SearchItem{Type: SearchTypeEpisode, ID: episode.ID, Name: episode.Name, URI: episode.URI})
+	}
+	return items
+}
+
+// idFromURI returns the ID part of a Spotify URI such as spotify:track:<id>
+func idFromURI(uri string) string {
+	return uri[strings.LastIndex(uri, ":")+1:]
 }
 
 // NewReleases holds the new releases
@@ -22,107 +87,291 @@ type Playlists struct {
 	Items []Playlist
 }
 
+// SearchTracks searches for tracks
 func (c *SpotifyClient) SearchTracks(query string) (SearchResults, error) {
-	var results SearchResults
-	
-	// URL encode the query
-	encodedQuery := url.QueryEscape(query)
-	reqURL := fmt.Sprintf("https://api.spotify.com/v1/search?q=%s&type=track&limit=10", encodedQuery)
-	
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return results, fmt.Errorf("error creating request: %v", err)
+	return c.Search(query, SearchOptions{Types: []string{SearchTypeTrack}})
+}
+
+// Search limits; the Web API rejects larger values
+const (
+	DefaultSearchLimit = 10
+	MaxSearchLimit     = 50
+	MaxSearchOffset    = 1000
+)
+
+// SearchOptions selects the types, filters and page of a search
+type SearchOptions struct {
+	Types   []string // no types means tracks only
+	Filters SearchFilters
+	Market  string // ISO 3166-1 alpha-2 country code; empty means the account's country
+	Limit   int    // results per type; 0 means DefaultSearchLimit
+	Offset  int
+}
+
+// SearchFilters narrow a search with the field filters of the search query
+type SearchFilters struct {
+	Artist string
+	Album  string
+	Year   string // a year or a range of years, e.g. 1990-1999
+	Genre  string
+	ISRC   string
+	Tag    string // "new" or "hipster"; albums only
+}
+
+var (
+	yearPattern   = regexp.MustCompile(`^(\d{4})(?:-(\d{4}))?$`)
+	isrcPattern   = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}\d{7}$`)
+	marketPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// Query returns the search query made of text followed by the field filters,
+// such as `daft artist:"daft punk" year:1990-1999`
+func (f SearchFilters) Query(text string) (string, error) {
+	var parts []string
+	if text = strings.TrimSpace(text); text != "" {
+		parts = append(parts, text)
 	}
 
-	req.Header.Add("Authorization", "Bearer "+c.AccessToken)
+	add := func(field, value string) error {
+		if value == "" {
+			return nil
+		}
+		value = filterValue(value)
+		if value == "" {
+			return fmt.Errorf("%s filter is empty", field)
+		}
+		parts = append(parts, field+":"+value)
+		return nil
+	}
+	if err := add("artist", f.Artist); err != nil {
+		return "", err
+	}
+	if err := add("album", f.Album); err != nil {
+		return "", err
+	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return results, fmt.Errorf("error making request: %v", err)
+	if f.Year != "" {
+		match := yearPattern.FindStringSubmatch(f.Year)
+		if match == nil || (match[2] != "" && match[2] < match[1]) {
+			return "", fmt.Errorf("year must be YYYY or YYYY-YYYY, not %s", f.Year)
+		}
+		parts = append(parts, "year:"+f.Year)
+	}
+	if err := add("genre", f.Genre); err != nil {
+		return "", err
+	}
+	if f.ISRC != "" {
+		isrc := strings.ToUpper(strings.ReplaceAll(f.ISRC, "-", ""))
+		if !isrcPattern.MatchString(isrc) {
+			return "", fmt.Errorf("ISRC must be 12 characters like USUM71703861, not %s", f.ISRC)
+		}
+		parts = append(parts, "isrc:"+isrc)
+	}
+	if f.Tag != "" {
+		tag := strings.ToLower(f.Tag)
+		if tag != "new" && tag != "hipster" {
+			return "", fmt.Errorf("tag must be new or hipster, not %s", f.Tag)
+		}
+		parts = append(parts, "tag:"+tag)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return results, fmt.Errorf("request failed with status %s", resp.Status)
+	if len(parts) == 0 {
+		return "", fmt.Errorf("search query is empty")
 	}
+	return strings.Join(parts, " "), nil
+}
 
-	var searchResponse struct {
-		Tracks struct {
-			Items []Track `json:"items"`
-		} `json:"tracks"`
+// filterValue returns a filter value as one term of the query. Values other than
+// a single word are quoted; the query syntax cannot escape double quotes, so
+// they are dropped.
+func filterValue(value string) string {
+	value = strings.Join(strings.Fields(strings.ReplaceAll(value, `"`, " ")), " ")
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return `"` + value + `"`
+		}
 	}
+	return value
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&searchResponse); err != nil {
-		return results, fmt.Errorf("error parsing response: %v", err)
+// Validate checks the options and returns the query to send for text
+func (o SearchOptions) Validate(text string) (string, error) {
+	for _, searchType := range o.Types {
+		if !slices.Contains(SearchTypes, searchType) {
+			return "", fmt.Errorf("invalid search type: %s. Valid types are: %s", searchType, strings.Join(SearchTypes, ", "))
+		}
+	}
+	if o.Filters.Tag != "" && len(o.Types) > 0 && !slices.Contains(o.Types, SearchTypeAlbum) {
+		return "", fmt.Errorf("tag filter only applies to albums")
+	}
+	if o.Market != "" && !marketPattern.MatchString(strings.ToUpper(o.Market)) {
+		return "", fmt.Errorf("market must be a two-letter country code, not %s", o.Market)
 	}
+	if o.Limit < 0 || o.Limit > MaxSearchLimit {
+		return "", fmt.Errorf("invalid search limit: %d. The limit must be between 1 and %d", o.Limit, MaxSearchLimit)
+	}
+	if o.Offset < 0 || o.Offset > MaxSearchOffset {
+		return "", fmt.Errorf("invalid search offset: %d. The offset must be between 0 and %d", o.Offset, MaxSearchOffset)
+	}
+	return o.Filters.Query(text)
+}
 
-	results.Tracks = searchResponse.Tracks.Items
+// paging is the part of a Web API paging object that locates the page
+type paging struct {
+	Offset   int    `json:"offset"`
+	Limit    int    `json:"limit"`
+	Total    int    `json:"total"`
+	Next     string `json:"next"`
+	Previous string `json:"previous"`
+}
 
-	// Display the results
-	fmt.Println("\n\033[1;36m╔══════════════════════════════════════════════════════════════════════════╗\033[0m")
-	fmt.Println("\033[1;36m║\033[0m \033[1;33mSearch Results:\033[0m                                                        \033[1;36m║\033[0m")
-	fmt.Println("\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
+// Search searches for items of the given types, one page at a time. The
+// filters are added to the query text.
+func (c *SpotifyClient) Search(text string, options SearchOptions) (SearchResults, error) {
+	query, err := options.Validate(text)
+	if err != nil {
+		return SearchResults{}, err
+	}
 
-	for i, track := range results.Tracks {
-		fmt.Printf("\033[1;36m║\033[0m \033[1;32m%2d.\033[0m %-70s \033[1;36m║\033[0m\n", i+1, truncateString(track.Name, 70))
-		fmt.Printf("\033[1;36m║\033[0m     \033[1;90mArtist:\033[0m %-66s \033[1;36m║\033[0m\n", truncateString(formatArtists(track.Artists), 66))
-		fmt.Printf("\033[1;36m║\033[0m     \033[1;90mAlbum:\033[0m %-67s \033[1;36m║\033[0m\n", truncateString(track.Album.Name, 67))
-		if i < len(results.Tracks)-1 {
-			fmt.Println("\033[1;36m║\033[0m                                                                          \033[1;36m║\033[0m")
+	types := options.Types
+	if len(types) == 0 {
+		// A tag filter alone implies albums
+		types = []string{SearchTypeTrack}
+		if options.Filters.Tag != "" {
+			types = []string{SearchTypeAlbum}
 		}
 	}
+	limit := options.Limit
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
 
-	fmt.Println("\033[1;36m╚══════════════════════════════════════════════════════════════════════════╝\033[0m")
-	return results, nil
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("type", strings.Join(types, ","))
+	params.Set("limit", strconv.Itoa(limit))
+	if options.Offset > 0 {
+		params.Set("offset", strconv.Itoa(options.Offset))
+	}
+	if options.Market != "" {
+		params.Set("market", strings.ToUpper(options.Market))
+	}
+	return c.search("/search?" + params.Encode())
 }
 
-// ShowNewReleases displays new album releases
-func (c *SpotifyClient) ShowNewReleases() (NewReleases, error) {
-	var results NewReleases
-	
-	reqURL := "https://api.spotify.com/v1/browse/new-releases?limit=10"
-	req, err := http.NewRequest("GET", reqURL, nil)
+// SearchPage fetches the page of results at link, the Next or Previous link of
+// earlier results
+func (c *SpotifyClient) SearchPage(link string) (SearchResults, error) {
+	reqPath, err := c.apiPath(link)
 	if err != nil {
-		return results, fmt.Errorf("error creating request: %v", err)
+		return SearchResults{}, fmt.Errorf("error following search link: %v", err)
 	}
+	return c.search(reqPath)
+}
 
-	req.Header.Add("Authorization", "Bearer "+c.AccessToken)
+// search sends a search request and collects the results of every type
+func (c *SpotifyClient) search(reqPath string) (SearchResults, error) {
+	var results SearchResults
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return results, fmt.Errorf("error making request: %v", err)
+	// Playlists, shows and episodes may contain null entries
+	var searchResponse struct {
+		Tracks *struct {
+			paging
+			Items []Track `json:"items"`
+		} `json:"tracks"`
+		Albums *struct {
+			paging
+			Items []Album `json:"items"`
+		} `json:"albums"`
+		Artists *struct {
+			paging
+			Items []Artist `json:"items"`
+		} `json:"artists"`
+		Playlists *struct {
+			paging
+			Items []*Playlist `json:"items"`
+		} `json:"playlists"`
+		Shows *struct {
+			paging
+			Items []*Show `json:"items"`
+		} `json:"shows"`
+		Episodes *struct {
+			paging
+			Items []*Episode `json:"items"`
+		} `json:"episodes"`
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return results, fmt.Errorf("request failed with status %s", resp.Status)
+	if _, err := c.do("GET", reqPath, nil, &searchResponse); err != nil {
+		return results, err
 	}
 
+	// Each type is paged separately, but the pages share the offset and limit
+	var pages []paging
+	if group := searchResponse.Tracks; group != nil {
+		results.Tracks = group.Items
+		pages = append(pages, group.paging)
+	}
+	if group := searchResponse.Albums; group != nil {
+		results.Albums = group.Items
+		pages = append(pages, group.paging)
+	}
+	if group := searchResponse.Artists; group != nil {
+		results.Artists = group.Items
+		pages = append(pages, group.paging)
+	}
+	if group := searchResponse.Playlists; group != nil {
+		for _, playlist := range group.Items {
+			if playlist != nil {
+				results.Playlists = append(results.Playlists, *playlist)
+			}
+		}
+		pages = append(pages, group.paging)
+	}
+	if group := searchResponse.Shows; group != nil {
+		for _, show := range group.Items {
+			if show != nil {
+				results.Shows = append(results.Shows, *show)
+			}
+		}
+		pages = append(pages, group.paging)
+	}
+	if group := searchResponse.Episodes; group != nil {
+		for _, episode := range group.Items {
+			if episode != nil {
+				results.Episodes = append(results.Episodes, *episode)
+			}
+		}
+		pages = append(pages, group.paging)
+	}
+
+	// The links of any type lead to the neighbouring page of all types
+	for _, page := range pages {
+		results.Offset, results.Limit = page.Offset, page.Limit
+		results.Total = max(results.Total, page.Total)
+		if results.Next == "" {
+			results.Next = page.Next
+		}
+		if results.Previous == "" {
+			results.Previous = page.Previous
+		}
+	}
+	return results, nil
+}
+
+// GetNewReleases returns new album releases
+func (c *SpotifyClient) GetNewReleases() (NewReleases, error) {
+	var results NewReleases
+
 	var newReleasesResponse struct {
 		Albums struct {
 			Items []Album `json:"items"`
 		} `json:"albums"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&newReleasesResponse); err != nil {
-		return results, fmt.Errorf("error parsing response: %v", err)
+	if _, err := c.do("GET", "/browse/new-releases?limit=10", nil, &newReleasesResponse); err != nil {
+		return results, err
 	}
 
 	results.Albums = newReleasesResponse.Albums.Items
-
-	// Display the results
-	fmt.Println("\n\033[1;36m╔══════════════════════════════════════════════════════════════════════════╗\033[0m")
-	fmt.Println("\033[1;36m║\033[0m \033[1;33mNew Releases:\033[0m                                                          \033[1;36m║\033[0m")
-	fmt.Println("\033[1;36m╠══════════════════════════════════════════════════════════════════════════╣\033[0m")
-
-	for i, album := range results.Albums {
-		fmt.Printf("\033[1;36m║\033[0m \033[1;32m%2d.\033[0m %-70s \033[1;36m║\033[0m\n", i+1, truncateString(album.Name, 70))
-		fmt.Printf("\033[1;36m║\033[0m     \033[1;90mArtist:\033[0m %-66s \033[1;36m║\033[0m\n", truncateString(formatArtists(album.Artists), 66))
-		if i < len(results.Albums)-1 {
-			fmt.Println("\033[1;36m║\033[0m                                                                          \033[1;36m║\033[0m")
-		}
-	}
-
-	fmt.Println("\033[1;36m╚══════════════════════════════════════════════════════════════════════════╝\033[0m")
 	return results, nil
 }
@@ -0,0 +1,141 @@
+package spotify_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	spotify "spotify-cli/src"
+)
+
+func TestSearchFiltersQuery(t *testing.T) {
+	tests := []struct {
+		text    string
+		filters spotify.SearchFilters
+		want    string
+	}{
+		{"hello", spotify.SearchFilters{}, "hello"},
+		{"", spotify.SearchFilters{Artist: "Daft Punk"}, `artist:"Daft Punk"`},
+		{"one", spotify.SearchFilters{Artist: "Muse", Album: "Origin of Symmetry"}, `one artist:Muse album:"Origin of Symmetry"`},
+		{"", spotify.SearchFilters{Artist: `Guns "N" Roses`}, `artist:"Guns N Roses"`},
+		{"", spotify.SearchFilters{Artist: "AC/DC"}, `artist:"AC/DC"`},
+		{"", spotify.SearchFilters{Album: "  Spaced   out "}, `album:"Spaced out"`},
+		{"", spotify.SearchFilters{Artist: "Sigur Rós"}, `artist:"Sigur Rós"`},
+		{"", spotify.SearchFilters{Artist: "Björk"}, "artist:Björk"},
+		{"", spotify.SearchFilters{Year: "1990-1999", Genre: "trip hop"}, `year:1990-1999 genre:"trip hop"`},
+		{"", spotify.SearchFilters{ISRC: "us-um7-17-03861"}, "isrc:USUM71703861"},
+		{"", spotify.SearchFilters{Tag: "New"}, "tag:new"},
+	}
+	for _, tt := range tests {
+		got, err := tt.filters.Query(tt.text)
+		if err != nil {
+			t.Errorf("Query(%q) with %+v: %v", tt.text, tt.filters, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Query(%q) with %+v = %s, want %s", tt.text, tt.filters, got, tt.want)
+		}
+	}
+
+	invalid := []spotify.SearchFilters{
+		{},
+		{Artist: `""`},
+		{Year: "199"},
+		{Year: "2000-1990"},
+		{Year: "1990-"},
+		{ISRC: "USUM7170386"},
+		{Tag: "old"},
+	}
+	for _, filters := range invalid {
+		if got, err := filters.Query(""); err == nil {
+			t.Errorf("Query with %+v = %s, want error", filters, got)
+		}
+	}
+}
+
+func TestSearchOptionsValidate(t *testing.T) {
+	invalid := []spotify.SearchOptions{
+		{Types: []string{"track"}, Filters: spotify.SearchFilters{Tag: "new"}},
+		{Market: "USA"},
+		{Market: "1A"},
+		{Limit: 51},
+		{Offset: -1},
+	}
+	for _, options := range invalid {
+		if _, err := options.Validate("hello"); err == nil {
+			t.Errorf("Validate with %+v succeeded, want error", options)
+		}
+	}
+}
+
+func TestSearchWithFilters(t *testing.T) {
+	client, server := newTestClient(t)
+
+	results, err := client.Search("hello", spotify.SearchOptions{
+		Filters: spotify.SearchFilters{Artist: "stub & the fakes", Year: "2020-2025"},
+		Market:  "gb",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Tracks) != 1 || results.Tracks[0].Name != "Hello Goodbye" {
+		t.Errorf("got tracks %+v, want Hello Goodbye", results.Tracks)
+	}
+
+	// The ampersand and the quotes of the query reach the server intact
+	requests := server.Requests()
+	request, err := url.Parse(strings.TrimPrefix(requests[len(requests)-1], "GET "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := request.Query()
+	if q := query.Get("q"); q != `hello artist:"stub & the fakes" year:2020-2025` {
+		t.Errorf("got q %s", q)
+	}
+	if market := query.Get("market"); market != "GB" {
+		t.Errorf("got market %q, want GB", market)
+	}
+
+	// A tag filter alone searches albums
+	results, err = client.Search("", spotify.SearchOptions{Filters: spotify.SearchFilters{Tag: "new"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Albums) != 2 || len(results.Tracks) != 0 {
+		t.Errorf("got %d albums and %d tracks, want the 2 new releases", len(results.Albums), len(results.Tracks))
+	}
+}
+
+func TestRankTracks(t *testing.T) {
+	track := func(name, artist string, popularity int) spotify.Track {
+		return spotify.Track{Name: name, Artists: []spotify.Artist{{Name: artist}}, Popularity: popularity}
+	}
+	tracks := []spotify.Track{
+		track("One More Time", "Daft Punk", 90),
+		track("One", "U2", 80),
+		track("One - Remastered", "Metallica", 50),
+		track("One", "Metallica", 70),
+	}
+
+	tests := []struct {
+		title, artist string
+		best          string // name and artist of the best match
+		candidates    int
+	}{
+		{"one", "metallica", "One/Metallica", 1},
+		{"ONE!", "", "One/U2", 2},
+		{"one metallica", "", "One/Metallica", 1},
+		{"one more time", "", "One More Time/Daft Punk", 1},
+		{"one", "daft", "One More Time/Daft Punk", 1},
+	}
+	for _, tt := range tests {
+		matches := spotify.RankTracks(tracks, tt.title, tt.artist)
+		best := matches[0].Track.Name + "/" + matches[0].Track.Artists[0].Name
+		if best != tt.best {
+			t.Errorf("RankTracks(%q, %q) ranked %s first, want %s", tt.title, tt.artist, best, tt.best)
+		}
+		if candidates := spotify.CloseMatches(matches); len(candidates) != tt.candidates {
+			t.Errorf("RankTracks(%q, %q) has %d close matches, want %d", tt.title, tt.artist, len(candidates), tt.candidates)
+		}
+	}
+}
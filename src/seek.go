@@ -0,0 +1,135 @@
+package spotify
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decimalPattern matches an unsigned decimal number such as 90 or 12.5
+var decimalPattern = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+// SeekTarget is a position in the current track: a time, an offset from the
+// current position, or a percentage of the track
+type SeekTarget struct {
+	// Ms is the time or offset in milliseconds; negative offsets seek backwards
+	Ms int
+	// Percent is a percentage of the track, used instead of Ms when IsPercent is set
+	Percent   float64
+	IsPercent bool
+	// Relative adds Ms or Percent to the current position
+	Relative bool
+}
+
+// ParseSeekTarget parses a seek position: a time such as 1:23, 1:02:03, 83,
+// 83s or 1m23s, an offset such as +15s or -1:00, or a percentage such as 50%
+// or +10%
+func ParseSeekTarget(s string) (SeekTarget, error) {
+	var target SeekTarget
+	text := strings.TrimSpace(s)
+
+	sign := 1
+	if rest, ok := strings.CutPrefix(text, "+"); ok {
+		text, target.Relative = rest, true
+	} else if rest, ok := strings.CutPrefix(text, "-"); ok {
+		text, target.Relative, sign = rest, true, -1
+	}
+	if text == "" {
+		return target, fmt.Errorf("%q is not a time, offset or percentage", s)
+	}
+
+	if number, ok := strings.CutSuffix(text, "%"); ok {
+		percent, err := strconv.ParseFloat(number, 64)
+		if err != nil || !decimalPattern.MatchString(number) || percent > 100 {
+			return target, fmt.Errorf("%s is not a percentage between 0 and 100", s)
+		}
+		target.Percent, target.IsPercent = float64(sign)*percent, true
+		return target, nil
+	}
+
+	ms, err := ParseTime(text)
+	if err != nil {
+		return target, fmt.Errorf("%s is not a time such as 1:23 or 90s, an offset such as +15s, or a percentage such as 50%%", s)
+	}
+	target.Ms = sign * ms
+	return target, nil
+}
+
+// ParseTime parses an unsigned time given as [h:]m:ss, as seconds, or as a
+// duration with units such as 1m30s, and returns it in milliseconds
+func ParseTime(s string) (int, error) {
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("too many fields")
+		}
+		total := 0
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 || strings.HasPrefix(part, "+") {
+				return 0, fmt.Errorf("invalid number: %q", part)
+			}
+			// Only the first field may exceed 59
+			if i > 0 && (n > 59 || len(part) != 2) {
+				return 0, fmt.Errorf("invalid minutes or seconds: %s", part)
+			}
+			total = total*60 + n
+		}
+		return total * 1000, nil
+	}
+
+	// A plain number is seconds
+	if decimalPattern.MatchString(s) {
+		seconds, err := strconv.ParseFloat(s, 64)
+		return int(seconds * 1000), err
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || strings.ContainsAny(s, "+-") {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return int(d.Milliseconds()), nil
+}
+
+// Position returns the position in milliseconds that the target points at in a
+// track of the given duration, playing at progress. Positions before the start
+// are clamped to it, and positions past the end to the last second, as seeking
+// past the end would skip to the next track.
+func (t SeekTarget) Position(progressMs, durationMs int) int {
+	position := t.Ms
+	if t.IsPercent {
+		position = int(t.Percent / 100 * float64(durationMs))
+	}
+	if t.Relative {
+		position += progressMs
+	}
+	return max(0, min(position, durationMs-1000))
+}
+
+// Seek moves playback within the current track and returns the player state
+// with the new position
+func (c *SpotifyClient) Seek(target SeekTarget) (*PlaybackState, error) {
+	state, err := c.GetPlaybackState()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, ErrNoActiveDevice
+	}
+	if state.Item == nil {
+		return nil, fmt.Errorf("nothing is playing")
+	}
+
+	position := target.Position(state.ProgressMs, state.Item.Duration)
+	if _, err := c.do("PUT", fmt.Sprintf("/me/player/seek?position_ms=%d", position), nil, nil); err != nil {
+		if IsStatus(err, http.StatusNotFound) {
+			return nil, ErrNoActiveDevice
+		}
+		return nil, fmt.Errorf("seek request failed: %w", err)
+	}
+	state.ProgressMs = position
+	return state, nil
+}
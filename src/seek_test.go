@@ -0,0 +1,69 @@
+package spotify_test
+
+import (
+	"testing"
+
+	spotify "spotify-cli/src"
+)
+
+func TestParseSeekTarget(t *testing.T) {
+	// Positions in a 3:00 track playing at 1:00
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"1:23", 83000},
+		{"0:05", 5000},
+		{"83", 83000},
+		{"12.5", 12500},
+		{"90s", 90000},
+		{"1m30s", 90000},
+		{"+15s", 75000},
+		{"-30s", 30000},
+		{"+1:00", 120000},
+		{"-2m", 0},
+		{"50%", 90000},
+		{"+10%", 78000},
+		{"100%", 179000},
+		{"5:00", 179000},
+		{"1:00:00", 179000},
+	}
+	for _, tt := range tests {
+		target, err := spotify.ParseSeekTarget(tt.in)
+		if err != nil {
+			t.Errorf("ParseSeekTarget(%q): %v", tt.in, err)
+			continue
+		}
+		if got := target.Position(60000, 180000); got != tt.want {
+			t.Errorf("ParseSeekTarget(%q).Position = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	invalid := []string{"", "+", "abc", "1:5", "1:60", "1:2:3:4", "1:-5", "101%", "-5%%", "1e3", "inf", "1x", "--5s", "+-5s", "-1m-5s"}
+	for _, in := range invalid {
+		if target, err := spotify.ParseSeekTarget(in); err == nil {
+			t.Errorf("ParseSeekTarget(%q) = %+v, want error", in, target)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	client, server := newTestClient(t)
+
+	target, _ := spotify.ParseSeekTarget("1:23")
+	state, err := client.Seek(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ProgressMs != 83000 || server.State().ProgressMs != 83000 {
+		t.Errorf("got position %d, server at %d; want 83000", state.ProgressMs, server.State().ProgressMs)
+	}
+
+	target, _ = spotify.ParseSeekTarget("+5m")
+	if state, err = client.Seek(target); err != nil {
+		t.Fatal(err)
+	}
+	if state.ProgressMs != 179000 {
+		t.Errorf("got position %d past the end, want 179000", state.ProgressMs)
+	}
+}
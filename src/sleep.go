@@ -0,0 +1,104 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SleepFade is how long a sleep timer fades the volume out before pausing
+const SleepFade = time.Minute
+
+// TrackTimeLeft returns the time until the current track ends
+func (c *SpotifyClient) TrackTimeLeft() (time.Duration, error) {
+	state, err := c.GetPlaybackState()
+	if err != nil {
+		return 0, err
+	}
+	if state == nil {
+		return 0, ErrNoActiveDevice
+	}
+	if state.Item == nil {
+		return 0, fmt.Errorf("nothing is playing")
+	}
+	return msDuration(state.Item.Duration - state.ProgressMs), nil
+}
+
+// AlbumTimeLeft returns the time until the album or playlist that is playing
+// ends, which is only known when it plays in order
+func (c *SpotifyClient) AlbumTimeLeft() (time.Duration, error) {
+	state, err := c.GetPlaybackState()
+	if err != nil {
+		return 0, err
+	}
+	if state == nil {
+		return 0, ErrNoActiveDevice
+	}
+	if state.Item == nil || state.Context == nil {
+		return 0, fmt.Errorf("no album or playlist is playing")
+	}
+	uri, err := ParseURI(state.Context.URI)
+	if err != nil || (uri.Type != SearchTypeAlbum && uri.Type != SearchTypePlaylist) {
+		return 0, fmt.Errorf("no album or playlist is playing")
+	}
+	if state.ShuffleState {
+		return 0, fmt.Errorf("the end of the %s is unknown while shuffle is on", uri.Type)
+	}
+
+	tracks, err := c.contextTracks(uri)
+	if err != nil {
+		return 0, err
+	}
+	for i, track := range tracks {
+		if track.URI != state.Item.URI {
+			continue
+		}
+		left := track.Duration - state.ProgressMs
+		for _, next := range tracks[i+1:] {
+			left += next.Duration
+		}
+		return msDuration(left), nil
+	}
+	return 0, fmt.Errorf("the playing track is not part of the %s", uri.Type)
+}
+
+// Sleep waits for d, then pauses playback. With a fade, the volume is lowered
+// to 0 over the last fade of d and restored once playback is paused, or failed
+// to pause, so the device is not left silent. When ctx is done first, playback
+// goes on and a volume already lowered is restored.
+func (c *SpotifyClient) Sleep(ctx context.Context, d, fade time.Duration) error {
+	fade = min(fade, d)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d - fade):
+	}
+
+	volume := 0
+	if fade > 0 {
+		var err error
+		if volume, err = c.GetVolume(); err != nil {
+			return err
+		}
+		if _, err := c.Fade(ctx, 0, fade); err != nil {
+			if restoreErr := c.SetVolume(volume); restoreErr != nil {
+				return restoreErr
+			}
+			return err
+		}
+	}
+
+	err := c.Pause()
+	if fade > 0 {
+		if restoreErr := c.SetVolume(volume); restoreErr != nil {
+			return errors.Join(err, restoreErr)
+		}
+	}
+	return err
+}
+
+// msDuration converts milliseconds to a duration, treating negative ones as 0
+func msDuration(ms int) time.Duration {
+	return time.Duration(max(ms, 0)) * time.Millisecond
+}
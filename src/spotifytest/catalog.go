@@ -0,0 +1,240 @@
+package spotifytest
+
+import "fmt"
+
+// Artist is a catalog artist
+type Artist struct {
+	ID     string
+	Name   string
+	Genres []string
+}
+
+// URI returns the Spotify URI of the artist
+func (a Artist) URI() string { return "spotify:artist:" + a.ID }
+
+// Album is a catalog album with its tracks
+type Album struct {
+	ID          string
+	Name        string
+	Artists     []Artist
+	ReleaseDate string
+	Tracks      []Track
+}
+
+// URI returns the Spotify URI of the album
+func (a Album) URI() string { return "spotify:album:" + a.ID }
+
+// Track is a catalog track
+type Track struct {
+	ID         string
+	Name       string
+	Artists    []Artist
+	AlbumID    string
+	DurationMs int
+	Popularity int
+	ISRC       string
+}
+
+// URI returns the Spotify URI of the track
+func (t Track) URI() string { return "spotify:track:" + t.ID }
+
+// Playlist is a catalog playlist owned by the current user or someone else
+type Playlist struct {
+	ID     string
+	Name   string
+	Owner  string
+	Tracks []Track
+}
+
+// URI returns the Spotify URI of the playlist
+func (p Playlist) URI() string { return "spotify:playlist:" + p.ID }
+
+// Show is a catalog podcast show with its episodes
+type Show struct {
+	ID        string
+	Name      string
+	Publisher string
+	Episodes  []Episode
+}
+
+// URI returns the Spotify URI of the show
+func (s Show) URI() string { return "spotify:show:" + s.ID }
+
+// Episode is a catalog podcast episode
+type Episode struct {
+	ID          string
+	Name        string
+	ShowID      string
+	DurationMs  int
+	ReleaseDate string
+}
+
+// URI returns the Spotify URI of the episode
+func (e Episode) URI() string { return "spotify:episode:" + e.ID }
+
+// track returns the episode as an item of the simulated player, which only
+// keeps tracks
+func (e Episode) track() Track {
+	return Track{ID: e.ID, Name: e.Name, DurationMs: e.DurationMs}
+}
+
+// Device is a Spotify Connect device
+type Device struct {
+	ID            string
+	Name          string
+	Type          string
+	IsActive      bool
+	IsRestricted  bool
+	VolumePercent int
+}
+
+// Catalog is the content served by the fake server
+type Catalog struct {
+	Artists     []Artist
+	Albums      []Album
+	Playlists   []Playlist
+	Shows       []Show
+	NewReleases []string // album IDs
+}
+
+// album returns the album with the given ID
+func (c *Catalog) album(id string) (Album, bool) {
+	for _, album := range c.Albums {
+		if album.ID == id {
+			return album, true
+		}
+	}
+	return Album{}, false
+}
+
+// playlist returns the playlist with the given ID
+func (c *Catalog) playlist(id string) (Playlist, bool) {
+	for _, playlist := range c.Playlists {
+		if playlist.ID == id {
+			return playlist, true
+		}
+	}
+	return Playlist{}, false
+}
+
+// show returns the show with the given ID
+func (c *Catalog) show(id string) (Show, bool) {
+	for _, show := range c.Shows {
+		if show.ID == id {
+			return show, true
+		}
+	}
+	return Show{}, false
+}
+
+// episodes returns every episode of every show in catalog order
+func (c *Catalog) episodes() []Episode {
+	var episodes []Episode
+	for _, show := range c.Shows {
+		episodes = append(episodes, show.Episodes...)
+	}
+	return episodes
+}
+
+// episode returns the episode with the given ID
+func (c *Catalog) episode(id string) (Episode, bool) {
+	for _, episode := range c.episodes() {
+		if episode.ID == id {
+			return episode, true
+		}
+	}
+	return Episode{}, false
+}
+
+// tracks returns every track of every album in catalog order
+func (c *Catalog) tracks() []Track {
+	var tracks []Track
+	for _, album := range c.Albums {
+		tracks = append(tracks, album.Tracks...)
+	}
+	return tracks
+}
+
+// track returns the track with the given ID
+func (c *Catalog) track(id string) (Track, bool) {
+	for _, track := range c.tracks() {
+		if track.ID == id {
+			return track, true
+		}
+	}
+	return Track{}, false
+}
+
+// artistTracks returns the tracks of every album by the given artist
+func (c *Catalog) artistTracks(id string) []Track {
+	var tracks []Track
+	for _, album := range c.Albums {
+		for _, artist := range album.Artists {
+			if artist.ID == id {
+				tracks = append(tracks, album.Tracks...)
+				break
+			}
+		}
+	}
+	return tracks
+}
+
+// DefaultCatalog returns a small catalog with a few artists, albums, playlists and a show
+func DefaultCatalog() Catalog {
+	artists := []Artist{
+		{ID: "artist1", Name: "The Testers", Genres: []string{"indie rock"}},
+		{ID: "artist2", Name: "Mock Orchestra", Genres: []string{"classical"}},
+		{ID: "artist3", Name: "Stub & The Fakes", Genres: []string{"pop", "synthpop"}},
+	}
+
+	newAlbum := func(id, name string, artist Artist, releaseDate string, trackNames ...string) Album {
+		album := Album{ID: id, Name: name, Artists: []Artist{artist}, ReleaseDate: releaseDate}
+		for i, trackName := range trackNames {
+			album.Tracks = append(album.Tracks, Track{
+				ID:         fmt.Sprintf("%s-track%d", id, i+1),
+				Name:       trackName,
+				Artists:    []Artist{artist},
+				AlbumID:    id,
+				DurationMs: 180000 + i*15000,
+				Popularity: 80 - i*10,
+				ISRC:       fmt.Sprintf("QZTST%s%05d", releaseDate[2:4], i+1),
+			})
+		}
+		return album
+	}
+
+	albums := []Album{
+		newAlbum("album1", "First Light", artists[0], "1994-03-01", "Hello World", "Green Tests", "Red Tests"),
+		newAlbum("album2", "Symphony of Stubs", artists[1], "2021-10-15", "Overture", "Hello Again", "Finale"),
+		newAlbum("album3", "Faking It", artists[2], "2024-05-20", "Pretend", "Mock Turtle", "Hello Goodbye"),
+	}
+
+	playlists := []Playlist{
+		{ID: "playlist1", Name: "Morning Mix", Owner: "tester", Tracks: []Track{albums[0].Tracks[0], albums[1].Tracks[1], albums[2].Tracks[2]}},
+		{ID: "playlist2", Name: "Focus", Owner: "tester", Tracks: albums[1].Tracks},
+		{ID: "playlist3", Name: "Sleep Sounds", Owner: "spotify", Tracks: []Track{albums[2].Tracks[0], albums[0].Tracks[2]}},
+	}
+
+	shows := []Show{
+		{ID: "show1", Name: "Testing Talk", Publisher: "Fake Radio", Episodes: []Episode{
+			{ID: "episode1", Name: "Hello Listeners", ShowID: "show1", DurationMs: 1800000, ReleaseDate: "2024-01-08"},
+			{ID: "episode2", Name: "Mocks and Stubs", ShowID: "show1", DurationMs: 2400000, ReleaseDate: "2024-01-15"},
+		}},
+	}
+
+	return Catalog{
+		Artists:     artists,
+		Albums:      albums,
+		Playlists:   playlists,
+		Shows:       shows,
+		NewReleases: []string{"album3", "album2"},
+	}
+}
+
+// DefaultDevices returns an active laptop and an idle phone
+func DefaultDevices() []Device {
+	return []Device{
+		{ID: "device1", Name: "Test Laptop", Type: "Computer", IsActive: true, VolumePercent: 50},
+		{ID: "device2", Name: "Test Phone", Type: "Smartphone", VolumePercent: 70},
+	}
+}
@@ -0,0 +1,1008 @@
+// Package spotifytest provides a fake Spotify Web API and accounts service for
+// end-to-end tests. It serves a small in-memory catalog and simulates a player
+// with Spotify Connect devices.
+package spotifytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Client credentials and refresh token accepted by the fake accounts service
+const (
+	ClientID     = "test-client-id"
+	ClientSecret = "test-client-secret"
+	RefreshToken = "test-refresh-token"
+)
+
+// Scopes granted to every token
+const grantedScopes = "user-read-playback-state user-modify-playback-state user-read-currently-playing playlist-read-private"
+
+// PlayerState is a snapshot of the simulated player
+type PlayerState struct {
+	IsPlaying  bool
+	ContextURI string
+	Tracks     []Track
+	Index      int
+	ProgressMs int
+	Shuffle    bool
+	Repeat     string
+	Devices    []Device
+	Queue      []Track // added to the queue, played before the rest of Tracks
+}
+
+// Item returns the current track, if any
+func (p PlayerState) Item() (Track, bool) {
+	if p.Index < 0 || p.Index >= len(p.Tracks) {
+		return Track{}, false
+	}
+	return p.Tracks[p.Index], true
+}
+
+// ActiveDevice returns the active device, if any
+func (p PlayerState) ActiveDevice() (Device, bool) {
+	for _, device := range p.Devices {
+		if device.IsActive {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// failure is an injected error response
+type failure struct {
+	request    string // "METHOD /path" of the request to fail, or empty for any request
+	after      int    // matching requests to let through first
+	status     int
+	retryAfter string
+}
+
+// Server is a fake Spotify service backed by httptest.Server
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	catalog  Catalog
+	player   PlayerState
+	tokens   map[string]bool
+	issued   int
+	failures []failure
+	requests []string
+}
+
+// NewServer starts a fake server with the default catalog and devices
+func NewServer() *Server {
+	return NewServerWithCatalog(DefaultCatalog(), DefaultDevices())
+}
+
+// NewServerWithCatalog starts a fake server serving the given catalog and devices
+func NewServerWithCatalog(catalog Catalog, devices []Device) *Server {
+	s := &Server{
+		catalog: catalog,
+		player:  PlayerState{Repeat: "off", Devices: devices},
+		tokens:  map[string]bool{},
+	}
+
+	// Start with the first album loaded and paused
+	if len(catalog.Albums) > 0 {
+		s.player.ContextURI = catalog.Albums[0].URI()
+		s.player.Tracks = catalog.Albums[0].Tracks
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /api/token", s.handleToken)
+	mux.HandleFunc("GET /v1/search", s.api(s.handleSearch))
+	mux.HandleFunc("GET /v1/browse/new-releases", s.api(s.handleNewReleases))
+	mux.HandleFunc("GET /v1/me/playlists", s.api(s.handlePlaylists))
+	mux.HandleFunc("GET /v1/albums/{id}/tracks", s.api(s.handleAlbumTracks))
+	mux.HandleFunc("GET /v1/playlists/{id}/tracks", s.api(s.handlePlaylistTracks))
+	mux.HandleFunc("GET /v1/me/player", s.api(s.handlePlayer))
+	mux.HandleFunc("PUT /v1/me/player", s.api(s.handleTransfer))
+	mux.HandleFunc("GET /v1/me/player/devices", s.api(s.handleDevices))
+	mux.HandleFunc("PUT /v1/me/player/play", s.api(s.handlePlay))
+	mux.HandleFunc("PUT /v1/me/player/pause", s.api(s.handlePause))
+	mux.HandleFunc("POST /v1/me/player/next", s.api(s.handleNext))
+	mux.HandleFunc("POST /v1/me/player/previous", s.api(s.handlePrevious))
+	mux.HandleFunc("PUT /v1/me/player/volume", s.api(s.handleVolume))
+	mux.HandleFunc("PUT /v1/me/player/repeat", s.api(s.handleRepeat))
+	mux.HandleFunc("PUT /v1/me/player/shuffle", s.api(s.handleShuffle))
+	mux.HandleFunc("PUT /v1/me/player/seek", s.api(s.handleSeek))
+	mux.HandleFunc("GET /v1/me/player/queue", s.api(s.handleQueue))
+	mux.HandleFunc("POST /v1/me/player/queue", s.api(s.handleAddToQueue))
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// APIBaseURL is the base URL to use as SpotifyClient.APIBaseURL
+func (s *Server) APIBaseURL() string { return s.URL + "/v1" }
+
+// AccountsBaseURL is the base URL to use as SpotifyClient.AccountsBaseURL
+func (s *Server) AccountsBaseURL() string { return s.URL }
+
+// State returns a snapshot of the player
+func (s *Server) State() PlayerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.player
+	state.Tracks = append([]Track(nil), s.player.Tracks...)
+	state.Devices = append([]Device(nil), s.player.Devices...)
+	state.Queue = append([]Track(nil), s.player.Queue...)
+	return state
+}
+
+// SetDevices replaces the available devices
+func (s *Server) SetDevices(devices []Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.player.Devices = devices
+}
+
+// ExpireTokens invalidates every issued access token so the next API call gets a 401
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]bool{}
+}
+
+// FailNext makes the next n API requests fail with status, sending retryAfter
+// as the Retry-After header when it is not empty
+func (s *Server) FailNext(n int, status int, retryAfter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, failure{status: status, retryAfter: retryAfter})
+	}
+}
+
+// FailRequest makes a request to path, relative to APIBaseURL, with method
+// fail with status once after letting the next `after` such requests through.
+// Other requests are left alone.
+func (s *Server) FailRequest(method, path string, after, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{request: method + " " + path, after: after, status: status})
+}
+
+// Requests returns the API requests received so far as "METHOD /path?query"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// api wraps an API handler with request logging, failure injection and bearer
+// token checks. The handler runs with the server lock held.
+func (s *Server) api(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+
+		for i, f := range s.failures {
+			if f.request != "" && f.request != r.Method+" "+strings.TrimPrefix(r.URL.Path, "/v1") {
+				continue
+			}
+			if f.after > 0 {
+				s.failures[i].after--
+				break
+			}
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			if f.retryAfter != "" {
+				w.Header().Set("Retry-After", f.retryAfter)
+			}
+			writeError(w, f.status, http.StatusText(f.status), "")
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !s.tokens[token] {
+			writeError(w, http.StatusUnauthorized, "The access token expired", "")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// handleAuthorize approves every authorization request and redirects back with a code
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != ClientID {
+		http.Error(w, "INVALID_CLIENT: Invalid client", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "INVALID_CLIENT: Invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	params := redirect.Query()
+	params.Set("code", "test-code")
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// handleToken issues access tokens for the authorization code and refresh token grants
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+
+	// Accept either Basic client authentication or a PKCE client_id
+	if id, secret, ok := r.BasicAuth(); ok {
+		if id != ClientID || secret != ClientSecret {
+			writeTokenError(w, "invalid_client")
+			return
+		}
+	} else if r.PostForm.Get("client_id") != ClientID {
+		writeTokenError(w, "invalid_client")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		if r.PostForm.Get("code") != "test-code" {
+			writeTokenError(w, "invalid_grant")
+			return
+		}
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != RefreshToken {
+			writeTokenError(w, "invalid_grant")
+			return
+		}
+	default:
+		writeTokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	s.mu.Lock()
+	s.issued++
+	token := fmt.Sprintf("test-access-token-%d", s.issued)
+	s.tokens[token] = true
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"expires_in":    3600,
+		"refresh_token": RefreshToken,
+		"scope":         grantedScopes,
+	})
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.ToLower(strings.TrimSpace(query.Get("q")))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "No search query", "")
+		return
+	}
+	if market := query.Get("market"); market != "" && len(market) != 2 {
+		writeError(w, http.StatusBadRequest, "Invalid market code", "")
+		return
+	}
+	text, filters := parseQuery(q)
+
+	types := strings.Split(query.Get("type"), ",")
+	response := map[string]interface{}{}
+	for _, kind := range types {
+		var items []interface{}
+		switch kind {
+		case "track":
+			for _, track := range s.catalog.tracks() {
+				album, _ := s.catalog.album(track.AlbumID)
+				if matches(text, track.Name, album.Name, artistNames(track.Artists)) &&
+					filters.match("artist", artistNames(track.Artists)) && filters.match("album", album.Name) &&
+					filters.matchYear(album.ReleaseDate) && filters.match("genre", artistGenres(track.Artists)) &&
+					filters.matchExact("isrc", track.ISRC) && filters["tag"] == "" {
+					items = append(items, s.trackJSON(track))
+				}
+			}
+		case "album":
+			for _, album := range s.catalog.Albums {
+				if matches(text, album.Name, artistNames(album.Artists)) &&
+					filters.match("artist", artistNames(album.Artists)) && filters.match("album", album.Name) &&
+					filters.matchYear(album.ReleaseDate) && s.matchTag(filters["tag"], album) &&
+					filters["genre"] == "" && filters["isrc"] == "" {
+					items = append(items, albumJSON(album))
+				}
+			}
+		case "artist":
+			for _, artist := range s.catalog.Artists {
+				if matches(text, artist.Name) && filters.match("artist", artist.Name) &&
+					filters.match("genre", artistGenres([]Artist{artist})) &&
+					filters["album"] == "" && filters["isrc"] == "" && filters["tag"] == "" {
+					items = append(items, artistJSON(artist))
+				}
+			}
+		case "playlist":
+			for _, playlist := range s.catalog.Playlists {
+				if matches(text, playlist.Name) && len(filters) == 0 {
+					items = append(items, playlistJSON(playlist))
+				}
+			}
+		case "show":
+			for _, show := range s.catalog.Shows {
+				if matches(text, show.Name, show.Publisher) && len(filters) == 0 {
+					items = append(items, showJSON(show))
+				}
+			}
+		case "episode":
+			for _, episode := range s.catalog.episodes() {
+				if matches(text, episode.Name) && len(filters) == 0 {
+					items = append(items, episodeJSON(episode))
+				}
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "Bad search type field "+kind, "")
+			return
+		}
+		response[kind+"s"] = page(r, items)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// matchTag reports whether an album has the tag: new albums are the new
+// releases, and no album of the catalog is obscure enough for hipster
+func (s *Server) matchTag(tag string, album Album) bool {
+	switch tag {
+	case "":
+		return true
+	case "new":
+		return slices.Contains(s.catalog.NewReleases, album.ID)
+	}
+	return false
+}
+
+func (s *Server) handleNewReleases(w http.ResponseWriter, r *http.Request) {
+	var items []interface{}
+	for _, id := range s.catalog.NewReleases {
+		if album, ok := s.catalog.album(id); ok {
+			items = append(items, albumJSON(album))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"albums": page(r, items)})
+}
+
+func (s *Server) handlePlaylists(w http.ResponseWriter, r *http.Request) {
+	var items []interface{}
+	for _, playlist := range s.catalog.Playlists {
+		items = append(items, playlistJSON(playlist))
+	}
+	writeJSON(w, http.StatusOK, page(r, items))
+}
+
+func (s *Server) handleAlbumTracks(w http.ResponseWriter, r *http.Request) {
+	album, ok := s.catalog.album(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Non existing id", "")
+		return
+	}
+	items := []interface{}{}
+	for _, track := range album.Tracks {
+		items = append(items, s.trackJSON(track))
+	}
+	writeJSON(w, http.StatusOK, page(r, items))
+}
+
+func (s *Server) handlePlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := s.catalog.playlist(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Non existing id", "")
+		return
+	}
+	items := []interface{}{}
+	for _, track := range playlist.Tracks {
+		items = append(items, map[string]interface{}{"track": s.trackJSON(track)})
+	}
+	writeJSON(w, http.StatusOK, page(r, items))
+}
+
+func (s *Server) handlePlayer(w http.ResponseWriter, r *http.Request) {
+	device, ok := s.player.ActiveDevice()
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	state := map[string]interface{}{
+		"device":                 deviceJSON(device),
+		"is_playing":             s.player.IsPlaying,
+		"progress_ms":            s.player.ProgressMs,
+		"shuffle_state":          s.player.Shuffle,
+		"repeat_state":           s.player.Repeat,
+		"currently_playing_type": "track",
+		"item":                   nil,
+		"context":                nil,
+	}
+	if track, ok := s.player.Item(); ok {
+		state["item"] = s.trackJSON(track)
+	}
+	if s.player.ContextURI != "" {
+		state["context"] = map[string]interface{}{"uri": s.player.ContextURI}
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (s *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DeviceIDs []string `json:"device_ids"`
+		Play      bool     `json:"play"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed json", "")
+		return
+	}
+	if len(body.DeviceIDs) != 1 {
+		writeError(w, http.StatusBadRequest, "Exactly one device id is required", "")
+		return
+	}
+	if !s.selectDevice(w, body.DeviceIDs[0]) {
+		return
+	}
+
+	if body.Play {
+		s.player.IsPlaying = true
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	devices := []interface{}{}
+	for _, device := range s.player.Devices {
+		devices = append(devices, deviceJSON(device))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"devices": devices})
+}
+
+func (s *Server) handlePlay(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+
+	var body struct {
+		ContextURI string   `json:"context_uri"`
+		URIs       []string `json:"uris"`
+		DeviceID   string   `json:"device_id"`
+		Offset     *struct {
+			Position int    `json:"position"`
+			URI      string `json:"uri"`
+		} `json:"offset"`
+		PositionMs int `json:"position_ms"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Malformed json", "")
+			return
+		}
+	}
+	if body.DeviceID != "" && !s.selectDevice(w, body.DeviceID) {
+		return
+	}
+
+	switch {
+	case body.ContextURI != "":
+		tracks, ok := s.contextTracks(body.ContextURI)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid context uri", "")
+			return
+		}
+		s.player.ContextURI = body.ContextURI
+		s.player.Tracks = tracks
+	case len(body.URIs) > 0:
+		var tracks []Track
+		for _, uri := range body.URIs {
+			track, ok := s.uriTrack(uri)
+			if !ok {
+				writeError(w, http.StatusBadRequest, "Invalid track uri: "+uri, "")
+				return
+			}
+			tracks = append(tracks, track)
+		}
+		s.player.ContextURI = ""
+		s.player.Tracks = tracks
+	default:
+		// Resume the current item
+		s.player.IsPlaying = true
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s.player.Index = 0
+	if body.Offset != nil {
+		s.player.Index = body.Offset.Position
+		for i, track := range s.player.Tracks {
+			if body.Offset.URI != "" && track.URI() == body.Offset.URI {
+				s.player.Index = i
+			}
+		}
+	}
+	s.player.ProgressMs = body.PositionMs
+	s.player.IsPlaying = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+	s.player.IsPlaying = false
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleNext(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+
+	switch {
+	case len(s.player.Queue) > 0:
+		// Queued tracks play next and are then gone from the queue
+		s.player.Tracks = slices.Insert(slices.Clone(s.player.Tracks), s.player.Index+1, s.player.Queue[0])
+		s.player.Queue = s.player.Queue[1:]
+		s.player.Index++
+	case s.player.Index+1 < len(s.player.Tracks):
+		s.player.Index++
+	case s.player.Repeat == "context":
+		s.player.Index = 0
+	default:
+		s.player.IsPlaying = false
+	}
+	s.player.ProgressMs = 0
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePrevious(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+
+	if s.player.Index > 0 {
+		s.player.Index--
+	}
+	s.player.ProgressMs = 0
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleVolume(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+
+	volume, err := strconv.Atoi(r.URL.Query().Get("volume_percent"))
+	if err != nil || volume < 0 || volume > 100 {
+		writeError(w, http.StatusBadRequest, "Invalid volume_percent", "")
+		return
+	}
+
+	for i := range s.player.Devices {
+		if s.player.Devices[i].IsActive {
+			s.player.Devices[i].VolumePercent = volume
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRepeat(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "off", "track", "context":
+		s.player.Repeat = state
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid repeat state", "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleShuffle(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+
+	shuffle, err := strconv.ParseBool(r.URL.Query().Get("state"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid shuffle state", "")
+		return
+	}
+	s.player.Shuffle = shuffle
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSeek(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+
+	position, err := strconv.Atoi(r.URL.Query().Get("position_ms"))
+	if err != nil || position < 0 {
+		writeError(w, http.StatusBadRequest, "Invalid position_ms", "")
+		return
+	}
+	track, ok := s.player.Item()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Player command failed: No track loaded", "")
+		return
+	}
+
+	// Seeking past the end starts the next track, like the real player
+	if position >= track.DurationMs {
+		s.handleNext(w, r)
+		return
+	}
+	s.player.ProgressMs = position
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	queue := map[string]interface{}{"currently_playing": nil, "queue": []interface{}{}}
+	if _, ok := s.player.ActiveDevice(); !ok {
+		writeJSON(w, http.StatusOK, queue)
+		return
+	}
+
+	if track, ok := s.player.Item(); ok {
+		queue["currently_playing"] = s.trackJSON(track)
+	}
+	var items []interface{}
+	for _, track := range s.player.Queue {
+		items = append(items, s.trackJSON(track))
+	}
+	if s.player.Index+1 < len(s.player.Tracks) {
+		for _, track := range s.player.Tracks[s.player.Index+1:] {
+			items = append(items, s.trackJSON(track))
+		}
+	}
+	if items != nil {
+		queue["queue"] = items
+	}
+	writeJSON(w, http.StatusOK, queue)
+}
+
+func (s *Server) handleAddToQueue(w http.ResponseWriter, r *http.Request) {
+	if !s.selectDevice(w, r.URL.Query().Get("device_id")) {
+		return
+	}
+
+	uri := r.URL.Query().Get("uri")
+	track, ok := s.uriTrack(uri)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid track uri: "+uri, "")
+		return
+	}
+	s.player.Queue = append(s.player.Queue, track)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// selectDevice activates the requested device, or checks that a device is active
+// when id is empty. It writes a 404 and returns false when neither is possible.
+func (s *Server) selectDevice(w http.ResponseWriter, id string) bool {
+	if id == "" {
+		if _, ok := s.player.ActiveDevice(); !ok {
+			writeError(w, http.StatusNotFound, "Player command failed: No active device found", "NO_ACTIVE_DEVICE")
+			return false
+		}
+		return true
+	}
+
+	found := false
+	for _, device := range s.player.Devices {
+		if device.ID == id {
+			found = true
+			if device.IsRestricted {
+				writeError(w, http.StatusForbidden, "Player command failed: Restriction violated", "UNKNOWN")
+				return false
+			}
+		}
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "Device not found", "")
+		return false
+	}
+
+	for i := range s.player.Devices {
+		s.player.Devices[i].IsActive = s.player.Devices[i].ID == id
+	}
+	return true
+}
+
+// uriTrack returns the track or episode with the given URI
+func (s *Server) uriTrack(uri string) (Track, bool) {
+	if id, ok := strings.CutPrefix(uri, "spotify:episode:"); ok {
+		episode, ok := s.catalog.episode(id)
+		return episode.track(), ok
+	}
+	return s.catalog.track(strings.TrimPrefix(uri, "spotify:track:"))
+}
+
+// contextTracks returns the tracks of an album, playlist, artist or show context
+func (s *Server) contextTracks(uri string) ([]Track, bool) {
+	parts := strings.Split(uri, ":")
+	if len(parts) != 3 || parts[0] != "spotify" {
+		return nil, false
+	}
+
+	switch parts[1] {
+	case "album":
+		album, ok := s.catalog.album(parts[2])
+		return album.Tracks, ok
+	case "playlist":
+		playlist, ok := s.catalog.playlist(parts[2])
+		return playlist.Tracks, ok
+	case "artist":
+		tracks := s.catalog.artistTracks(parts[2])
+		return tracks, len(tracks) > 0
+	case "show":
+		show, ok := s.catalog.show(parts[2])
+		var tracks []Track
+		for _, episode := range show.Episodes {
+			tracks = append(tracks, episode.track())
+		}
+		return tracks, ok
+	}
+	return nil, false
+}
+
+// queryFilters are the field filters of a search query, by field name
+type queryFilters map[string]string
+
+// parseQuery splits a lowercase search query into its free text and its field
+// filters, such as artist:"daft punk" or year:1990-1999
+func parseQuery(q string) (string, queryFilters) {
+	var text []string
+	filters := queryFilters{}
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		// A term is a word or a quoted phrase, optionally after a field name
+		field := ""
+		if i := strings.IndexAny(q, ": \""); i > 0 && q[i] == ':' {
+			field, q = q[:i], q[i+1:]
+		}
+		var value string
+		if rest, ok := strings.CutPrefix(q, `"`); ok {
+			value, q, _ = strings.Cut(rest, `"`)
+		} else {
+			value, q, _ = strings.Cut(q, " ")
+		}
+		if field == "" {
+			text = append(text, value)
+		} else {
+			filters[field] = value
+		}
+	}
+	return strings.Join(text, " "), filters
+}
+
+// match reports whether value contains the filter for field, if there is one
+func (f queryFilters) match(field, value string) bool {
+	filter, ok := f[field]
+	return !ok || strings.Contains(strings.ToLower(value), filter)
+}
+
+// matchExact reports whether value equals the filter for field, if there is one
+func (f queryFilters) matchExact(field, value string) bool {
+	filter, ok := f[field]
+	return !ok || strings.EqualFold(value, filter)
+}
+
+// matchYear reports whether a release date lies in the year filter, if there is one
+func (f queryFilters) matchYear(releaseDate string) bool {
+	filter, ok := f["year"]
+	if !ok {
+		return true
+	}
+	from, to, found := strings.Cut(filter, "-")
+	if !found {
+		to = from
+	}
+	year := releaseDate[:min(4, len(releaseDate))]
+	return year >= from && year <= to
+}
+
+// matches reports whether any of the fields contains the lowercase query
+func matches(q string, fields ...string) bool {
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), q) {
+			return true
+		}
+	}
+	return false
+}
+
+func artistGenres(artists []Artist) string {
+	var genres []string
+	for _, artist := range artists {
+		genres = append(genres, artist.Genres...)
+	}
+	return strings.Join(genres, ", ")
+}
+
+func artistNames(artists []Artist) string {
+	names := make([]string, len(artists))
+	for i, artist := range artists {
+		names[i] = artist.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// page returns a Spotify paging object for the limit and offset query parameters
+func page(r *http.Request, items []interface{}) map[string]interface{} {
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(query.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// link returns the URL of the same request at another offset
+	link := func(offset int) string {
+		params := r.URL.Query()
+		params.Set("offset", strconv.Itoa(offset))
+		params.Set("limit", strconv.Itoa(limit))
+		return "http://" + r.Host + r.URL.Path + "?" + params.Encode()
+	}
+
+	pageItems := []interface{}{}
+	if offset < len(items) {
+		end := offset + limit
+		if end > len(items) {
+			end = len(items)
+		}
+		pageItems = items[offset:end]
+	}
+
+	result := map[string]interface{}{
+		"href":     link(offset),
+		"items":    pageItems,
+		"limit":    limit,
+		"offset":   offset,
+		"total":    len(items),
+		"next":     nil,
+		"previous": nil,
+	}
+	if offset+limit < len(items) {
+		result["next"] = link(offset + limit)
+	}
+	if offset > 0 {
+		previous := offset - limit
+		if previous < 0 {
+			previous = 0
+		}
+		result["previous"] = link(previous)
+	}
+	return result
+}
+
+func artistJSON(artist Artist) map[string]interface{} {
+	genres := []string{}
+	genres = append(genres, artist.Genres...)
+	return map[string]interface{}{
+		"id":     artist.ID,
+		"name":   artist.Name,
+		"type":   "artist",
+		"uri":    artist.URI(),
+		"genres": genres,
+	}
+}
+
+func albumJSON(album Album) map[string]interface{} {
+	artists := []interface{}{}
+	for _, artist := range album.Artists {
+		artists = append(artists, artistJSON(artist))
+	}
+	return map[string]interface{}{
+		"id":           album.ID,
+		"name":         album.Name,
+		"type":         "album",
+		"album_type":   "album",
+		"uri":          album.URI(),
+		"artists":      artists,
+		"release_date": album.ReleaseDate,
+		"total_tracks": len(album.Tracks),
+	}
+}
+
+func (s *Server) trackJSON(track Track) map[string]interface{} {
+	artists := []interface{}{}
+	for _, artist := range track.Artists {
+		artists = append(artists, artistJSON(artist))
+	}
+	album, _ := s.catalog.album(track.AlbumID)
+	return map[string]interface{}{
+		"id":          track.ID,
+		"name":        track.Name,
+		"type":        "track",
+		"uri":         track.URI(),
+		"artists":     artists,
+		"album":       albumJSON(album),
+		"duration_ms": track.DurationMs,
+		"popularity":  track.Popularity,
+	}
+}
+
+func playlistJSON(playlist Playlist) map[string]interface{} {
+	return map[string]interface{}{
+		"id":     playlist.ID,
+		"name":   playlist.Name,
+		"type":   "playlist",
+		"uri":    playlist.URI(),
+		"owner":  map[string]interface{}{"id": playlist.Owner, "display_name": playlist.Owner},
+		"tracks": map[string]interface{}{"total": len(playlist.Tracks)},
+	}
+}
+
+func showJSON(show Show) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             show.ID,
+		"name":           show.Name,
+		"type":           "show",
+		"uri":            show.URI(),
+		"publisher":      show.Publisher,
+		"total_episodes": len(show.Episodes),
+	}
+}
+
+func episodeJSON(episode Episode) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           episode.ID,
+		"name":         episode.Name,
+		"type":         "episode",
+		"uri":          episode.URI(),
+		"duration_ms":  episode.DurationMs,
+		"release_date": episode.ReleaseDate,
+	}
+}
+
+func deviceJSON(device Device) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             device.ID,
+		"name":           device.Name,
+		"type":           device.Type,
+		"is_active":      device.IsActive,
+		"is_restricted":  device.IsRestricted,
+		"volume_percent": device.VolumePercent,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a Web API error object
+func writeError(w http.ResponseWriter, status int, message, reason string) {
+	body := map[string]interface{}{"status": status, "message": message}
+	if reason != "" {
+		body["reason"] = reason
+	}
+	writeJSON(w, status, map[string]interface{}{"error": body})
+}
+
+// writeTokenError writes an accounts service error
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": code})
+}
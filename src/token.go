@@ -0,0 +1,162 @@
+package spotify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long before expiry an access token is refreshed
+const tokenExpiryLeeway = time.Minute
+
+// Refresh token file used by older versions, imported once into the token store
+const legacyRefreshTokenFile = ".refresh_token"
+
+// ErrNoToken is returned by a TokenStore that has no saved token
+var ErrNoToken = errors.New("no saved token")
+
+// Token is the persisted OAuth token record
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+	Scopes       []string  `json:"scopes,omitempty"`
+}
+
+// Expired reports whether the access token is missing or expires within leeway
+func (t *Token) Expired(leeway time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return true
+	}
+	if t.Expiry.IsZero() {
+		return false
+	}
+	return time.Now().Add(leeway).After(t.Expiry)
+}
+
+// TokenStore persists tokens between sessions
+type TokenStore interface {
+	// Load returns the saved token or ErrNoToken
+	Load() (*Token, error)
+	// Save replaces the saved token
+	Save(token *Token) error
+}
+
+// FileTokenStore stores the token as JSON in a single file
+type FileTokenStore struct {
+	Path string
+}
+
+// Load reads the token file, importing a legacy .refresh_token file if present
+func (s *FileTokenStore) Load() (*Token, error) {
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return s.importLegacy()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %v", err)
+	}
+
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("error parsing token file: %v", err)
+	}
+	return &token, nil
+}
+
+// Save writes the token file with owner-only permissions
+func (s *FileTokenStore) Save(token *Token) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return fmt.Errorf("error creating token directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding token: %v", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated token
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing token file: %v", err)
+	}
+	if err := os.Rename(tmp, s.Path); err != nil {
+		return fmt.Errorf("error writing token file: %v", err)
+	}
+	return nil
+}
+
+// importLegacy moves a refresh token saved in the working directory into the store
+func (s *FileTokenStore) importLegacy() (*Token, error) {
+	refreshToken, err := os.ReadFile(legacyRefreshTokenFile)
+	if err != nil || len(strings.TrimSpace(string(refreshToken))) == 0 {
+		return nil, ErrNoToken
+	}
+
+	token := &Token{RefreshToken: strings.TrimSpace(string(refreshToken))}
+	if err := s.Save(token); err != nil {
+		return nil, err
+	}
+	os.Remove(legacyRefreshTokenFile)
+	return token, nil
+}
+
+// DefaultTokenStore returns a FileTokenStore under the user's XDG state directory
+func DefaultTokenStore() (*FileTokenStore, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return &FileTokenStore{Path: filepath.Join(dir, "token.json")}, nil
+}
+
+// StateDir returns $XDG_STATE_HOME/spotify-cli, defaulting to ~/.local/state/spotify-cli
+func StateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "spotify-cli"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding home directory: %v", err)
+	}
+	return filepath.Join(home, ".local", "state", "spotify-cli"), nil
+}
+
+// MemoryTokenStore keeps the token in memory only, for tests and one-off sessions
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewMemoryTokenStore returns a MemoryTokenStore holding token, which may be nil
+func NewMemoryTokenStore(token *Token) *MemoryTokenStore {
+	return &MemoryTokenStore{token: token}
+}
+
+// Load returns a copy of the stored token or ErrNoToken
+func (s *MemoryTokenStore) Load() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil {
+		return nil, ErrNoToken
+	}
+	token := *s.token
+	return &token, nil
+}
+
+// Save replaces the stored token
+func (s *MemoryTokenStore) Save(token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *token
+	s.token = &saved
+	return nil
+}
@@ -1,33 +1,67 @@
 package spotify
 
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
 // SpotifyClient handles authentication and API requests
 type SpotifyClient struct {
 	ClientID     string
 	ClientSecret string
-	AccessToken  string
+	// UsePKCE selects the Authorization Code with PKCE flow, which does not need ClientSecret
+	UsePKCE bool
+	// TokenStore persists the token between sessions; nil keeps it in memory only
+	TokenStore TokenStore
+	// Retry controls retries of rate-limited (429) and temporarily failing (502/503/504) requests
+	Retry RetryPolicy
+	// APIBaseURL overrides DefaultAPIBaseURL, e.g. to point at a local stand-in
+	APIBaseURL string
+	// AccountsBaseURL overrides DefaultAccountsBaseURL for authorization and token requests
+	AccountsBaseURL string
+	// HTTPClient is used for all requests; nil uses http.DefaultClient
+	HTTPClient *http.Client
+	// Device is the name or ID of the device to play on; empty picks one, see ResolveDevice
+	Device string
+	// DefaultDevice is the name of the device to play on when it is available and no Device is selected
+	DefaultDevice string
+	// Console receives the authorization prompts and warnings; nil uses os.Stdout
+	Console io.Writer
+
+	mu    sync.Mutex
+	token *Token
 }
 
 // Artist represents a Spotify artist
 type Artist struct {
-	Name string `json:"name"`
-	URI  string `json:"uri"`
+	Name   string   `json:"name"`
+	URI    string   `json:"uri"`
+	ID     string   `json:"id"`
+	Genres []string `json:"genres"`
 }
 
 // Album represents a Spotify album
 type Album struct {
-	Name    string   `json:"name"`
-	URI     string   `json:"uri"`
-	ID      string   `json:"id"`
-	Artists []Artist `json:"artists"`
+	Name        string   `json:"name"`
+	URI         string   `json:"uri"`
+	ID          string   `json:"id"`
+	Artists     []Artist `json:"artists"`
+	AlbumType   string   `json:"album_type"`
+	ReleaseDate string   `json:"release_date"`
+	TotalTracks int      `json:"total_tracks"`
 }
 
 // Track represents a Spotify track
 type Track struct {
-	Name     string   `json:"name"`
-	URI      string   `json:"uri"`
-	Artists  []Artist `json:"artists"`
-	Album    Album    `json:"album"`
-	Duration int      `json:"duration_ms"`
+	Name       string   `json:"name"`
+	URI        string   `json:"uri"`
+	Artists    []Artist `json:"artists"`
+	Album      Album    `json:"album"`
+	Duration   int      `json:"duration_ms"`
+	Popularity int      `json:"popularity"`
+	// Type is "track", or "episode" for the episodes of a queue
+	Type string `json:"type"`
 }
 
 // SearchResult represents a Spotify search result
@@ -50,6 +84,24 @@ type Playlist struct {
 	} `json:"tracks"`
 }
 
+// Show represents a podcast or other show
+type Show struct {
+	Name          string `json:"name"`
+	URI           string `json:"uri"`
+	ID            string `json:"id"`
+	Publisher     string `json:"publisher"`
+	TotalEpisodes int    `json:"total_episodes"`
+}
+
+// Episode represents an episode of a show
+type Episode struct {
+	Name        string `json:"name"`
+	URI         string `json:"uri"`
+	ID          string `json:"id"`
+	Duration    int    `json:"duration_ms"`
+	ReleaseDate string `json:"release_date"`
+}
+
 // NewReleasesResult represents Spotify's new releases
 type NewReleasesResult struct {
 	Albums struct {
@@ -62,3 +114,30 @@ type PlaylistsResult struct {
 	Items []Playlist `json:"items"`
 	Total int        `json:"total"`
 }
+
+// Device represents a Spotify Connect device
+type Device struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	IsActive      bool   `json:"is_active"`
+	IsRestricted  bool   `json:"is_restricted"`
+	VolumePercent int    `json:"volume_percent"`
+}
+
+// PlaybackContext is the album, playlist or artist that playback started from
+type PlaybackContext struct {
+	URI  string `json:"uri"`
+	Type string `json:"type"`
+}
+
+// PlaybackState represents the player state returned by /me/player
+type PlaybackState struct {
+	Item         *Track           `json:"item"`
+	IsPlaying    bool             `json:"is_playing"`
+	ProgressMs   int              `json:"progress_ms"`
+	ShuffleState bool             `json:"shuffle_state"`
+	RepeatState  string           `json:"repeat_state"`
+	Device       Device           `json:"device"`
+	Context      *PlaybackContext `json:"context"`
+}
@@ -0,0 +1,81 @@
+package spotify
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// idPattern matches a Spotify ID. Real IDs are 22 base62 characters; any letters,
+// digits, - and _ are accepted so that the check does not reject future IDs.
+var idPattern = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// SpotifyURI identifies a track, album, playlist, artist, show or episode; Type
+// is one of SearchTypes
+type SpotifyURI struct {
+	Type string
+	ID   string
+}
+
+// ParseURI parses a Spotify URI such as spotify:track:<id> or an open.spotify.com
+// link such as https://open.spotify.com/intl-de/album/<id>?si=abc
+func ParseURI(s string) (SpotifyURI, error) {
+	s = strings.TrimSpace(s)
+
+	var parts []string
+	if rest, ok := strings.CutPrefix(s, "spotify:"); ok {
+		parts = strings.Split(rest, ":")
+	} else {
+		link := s
+		if !strings.Contains(link, "://") {
+			link = "https://" + link
+		}
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || (u.Host != "open.spotify.com" && u.Host != "play.spotify.com") {
+			return SpotifyURI{}, fmt.Errorf("not a Spotify URI or link: %s", s)
+		}
+		parts = strings.Split(strings.Trim(u.Path, "/"), "/")
+
+		// Drop a localized prefix such as intl-de and the embed player prefix
+		if len(parts) > 0 && strings.HasPrefix(parts[0], "intl-") {
+			parts = parts[1:]
+		}
+		if len(parts) > 0 && parts[0] == "embed" {
+			parts = parts[1:]
+		}
+	}
+
+	// Older playlist URIs and links name the owner first: user:<name>:playlist:<id>
+	if len(parts) == 4 && parts[0] == "user" && parts[2] == SearchTypePlaylist {
+		parts = parts[2:]
+	}
+	if len(parts) != 2 || !slices.Contains(SearchTypes, parts[0]) {
+		return SpotifyURI{}, fmt.Errorf("unsupported Spotify URI or link: %s", s)
+	}
+	if !idPattern.MatchString(parts[1]) {
+		return SpotifyURI{}, fmt.Errorf("invalid Spotify ID in %s", s)
+	}
+	return SpotifyURI{Type: parts[0], ID: parts[1]}, nil
+}
+
+// String returns the URI in the spotify:<type>:<id> form
+func (u SpotifyURI) String() string {
+	return "spotify:" + u.Type + ":" + u.ID
+}
+
+// URL returns the open.spotify.com link of the URI
+func (u SpotifyURI) URL() string {
+	return "https://open.spotify.com/" + u.Type + "/" + u.ID
+}
+
+// IsContext reports whether the URI is played as a context, such as an album,
+// rather than as a single track or episode
+func (u SpotifyURI) IsContext() bool {
+	switch u.Type {
+	case SearchTypeAlbum, SearchTypeArtist, SearchTypePlaylist, SearchTypeShow:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package spotify_test
+
+import (
+	"testing"
+
+	spotify "spotify-cli/src"
+)
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"spotify:track:4uLU6hMCjMI75M1A2tKUQC", "spotify:track:4uLU6hMCjMI75M1A2tKUQC"},
+		{"spotify:album:6dVIqQ8qmQ5GBnJ9shOYGE", "spotify:album:6dVIqQ8qmQ5GBnJ9shOYGE"},
+		{"spotify:user:someone:playlist:37i9dQZF1DXcBWIGoYBM5M", "spotify:playlist:37i9dQZF1DXcBWIGoYBM5M"},
+		{"spotify:episode:512ojhOuo1ktJprKbVcKyQ", "spotify:episode:512ojhOuo1ktJprKbVcKyQ"},
+		{"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC", "spotify:track:4uLU6hMCjMI75M1A2tKUQC"},
+		{"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC?si=1a2b3c4d5e6f", "spotify:track:4uLU6hMCjMI75M1A2tKUQC"},
+		{"https://open.spotify.com/intl-de/album/6dVIqQ8qmQ5GBnJ9shOYGE?si=x&nd=1", "spotify:album:6dVIqQ8qmQ5GBnJ9shOYGE"},
+		{"http://open.spotify.com/artist/0OdUWJ0sBjDrqHygGUXeCF/", "spotify:artist:0OdUWJ0sBjDrqHygGUXeCF"},
+		{"open.spotify.com/show/38bS44xjbVVZ3No3ByF1dJ", "spotify:show:38bS44xjbVVZ3No3ByF1dJ"},
+		{"https://open.spotify.com/embed/playlist/37i9dQZF1DXcBWIGoYBM5M", "spotify:playlist:37i9dQZF1DXcBWIGoYBM5M"},
+		{"https://open.spotify.com/user/someone/playlist/37i9dQZF1DXcBWIGoYBM5M", "spotify:playlist:37i9dQZF1DXcBWIGoYBM5M"},
+		{" spotify:track:album1-track1 ", "spotify:track:album1-track1"},
+	}
+	for _, tt := range tests {
+		uri, err := spotify.ParseURI(tt.in)
+		if err != nil {
+			t.Errorf("ParseURI(%q): %v", tt.in, err)
+			continue
+		}
+		if uri.String() != tt.want {
+			t.Errorf("ParseURI(%q) = %s, want %s", tt.in, uri, tt.want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"hello",
+		"spotify:track:",
+		"spotify:track",
+		"spotify:local:artist:album:title:180",
+		"spotify:user:someone",
+		"spotify:track:abc:def",
+		"spotify:track:abc def",
+		"https://example.com/track/4uLU6hMCjMI75M1A2tKUQC",
+		"https://open.spotify.com/",
+		"https://open.spotify.com/genre/pop",
+		"ftp://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC",
+	}
+	for _, in := range invalid {
+		if uri, err := spotify.ParseURI(in); err == nil {
+			t.Errorf("ParseURI(%q) = %s, want error", in, uri)
+		}
+	}
+
+	uri := spotify.SpotifyURI{Type: "album", ID: "6dVIqQ8qmQ5GBnJ9shOYGE"}
+	if got := uri.URL(); got != "https://open.spotify.com/album/6dVIqQ8qmQ5GBnJ9shOYGE" {
+		t.Errorf("URL() = %s", got)
+	}
+	if !uri.IsContext() {
+		t.Error("album is not a context")
+	}
+}
@@ -1,6 +1,9 @@
 package spotify
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 func formatArtists(artists []Artist) string {
 	names := make([]string, len(artists))
@@ -9,3 +12,12 @@ func formatArtists(artists []Artist) string {
 	}
 	return strings.Join(names, ", ")
 }
+
+// FormatTime formats milliseconds as m:ss, or h:mm:ss from an hour on
+func FormatTime(ms int) string {
+	seconds := ms / 1000
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, (seconds/60)%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
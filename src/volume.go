@@ -0,0 +1,70 @@
+package spotify
+
+import (
+	"context"
+	"time"
+)
+
+// fadeInterval is the shortest time between two volume changes of a fade,
+// which keeps long fades from flooding the API
+const fadeInterval = 500 * time.Millisecond
+
+// GetVolume returns the volume of the active device
+func (c *SpotifyClient) GetVolume() (int, error) {
+	state, err := c.GetPlaybackState()
+	if err != nil {
+		return 0, err
+	}
+	if state == nil {
+		return 0, ErrNoActiveDevice
+	}
+	return state.Device.VolumePercent, nil
+}
+
+// ChangeVolume raises or, for a negative delta, lowers the volume, keeping it
+// within 0-100, and returns the new volume
+func (c *SpotifyClient) ChangeVolume(delta int) (int, error) {
+	volume, err := c.GetVolume()
+	if err != nil {
+		return 0, err
+	}
+	volume = max(0, min(volume+delta, 100))
+	return volume, c.SetVolume(volume)
+}
+
+// Fade changes the volume to target in even steps over duration, at most one
+// step every fadeInterval. It stops early when ctx is done and returns the
+// last volume set, with ctx.Err() if the fade did not finish.
+func (c *SpotifyClient) Fade(ctx context.Context, target int, duration time.Duration) (int, error) {
+	start, err := c.GetVolume()
+	if err != nil {
+		return 0, err
+	}
+
+	diff := target - start
+	steps := max(1, min(int(duration/fadeInterval), abs(diff)))
+	interval := duration / time.Duration(steps)
+
+	volume := start
+	for i := 1; i <= steps && volume != target; i++ {
+		select {
+		case <-ctx.Done():
+			return volume, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		next := start + diff*i/steps
+		if err := c.SetVolume(next); err != nil {
+			return volume, err
+		}
+		volume = next
+	}
+	return volume, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}